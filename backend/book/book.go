@@ -0,0 +1,139 @@
+// Package book is an opening book: a table from early positions to
+// weighted moves that the bot can pick from instead of thinking, so that
+// its openings are both sound and varied. Positions that are mirror
+// images of each other share one entry.
+package book
+
+import (
+	"errors"
+	"math/rand"
+	"sort"
+
+	"4-in-a-row/engine"
+)
+
+// maxWeight caps a move's weight so it fits the file format.
+const maxWeight = 1<<16 - 1
+
+var ErrWrongBoard = errors.New("position does not match the book's board size")
+
+// Move is a book move with its weight. Moves are picked with probability
+// proportional to their weight.
+type Move struct {
+	Column int
+	Weight int
+}
+
+// Book maps positions on one board size to weighted moves. The zero value
+// is not usable; create books with New or Load. A Book is safe for
+// concurrent lookups but not for lookups during Add.
+type Book struct {
+	rows, columns, winLength int
+	// entries is keyed by the canonical hash of a position, the smaller
+	// of its own and its mirror image's hash; columns in the moves are in
+	// the orientation that hash came from.
+	entries map[uint64][]Move
+}
+
+// New returns an empty book for the given board.
+func New(rows, columns, winLength int) *Book {
+	return &Book{
+		rows:      rows,
+		columns:   columns,
+		winLength: winLength,
+		entries:   make(map[uint64][]Move),
+	}
+}
+
+func (b *Book) Rows() int      { return b.rows }
+func (b *Book) Columns() int   { return b.columns }
+func (b *Book) WinLength() int { return b.winLength }
+
+// Len returns the number of positions in the book.
+func (b *Book) Len() int { return len(b.entries) }
+
+// Fits reports whether pos is on the book's board.
+func (b *Book) Fits(pos *engine.Position) bool {
+	return pos.Rows() == b.rows && pos.Columns() == b.columns && pos.WinLength() == b.winLength
+}
+
+// Add adds weight to column as a move from pos.
+func (b *Book) Add(pos *engine.Position, column, weight int) error {
+	if !b.Fits(pos) {
+		return ErrWrongBoard
+	}
+	key, mirrored := canonical(pos)
+	if mirrored {
+		column = b.columns - 1 - column
+	}
+	moves := b.entries[key]
+	for i := range moves {
+		if moves[i].Column == column {
+			moves[i].Weight = min(moves[i].Weight+weight, maxWeight)
+			return nil
+		}
+	}
+	b.entries[key] = append(moves, Move{Column: column, Weight: min(weight, maxWeight)})
+	return nil
+}
+
+// Moves returns the book moves for pos, heaviest first, or nil if pos is
+// not in the book.
+func (b *Book) Moves(pos *engine.Position) []Move {
+	if !b.Fits(pos) {
+		return nil
+	}
+	key, mirrored := canonical(pos)
+	stored := b.entries[key]
+	if len(stored) == 0 {
+		return nil
+	}
+	moves := make([]Move, 0, len(stored))
+	for _, m := range stored {
+		if mirrored {
+			m.Column = b.columns - 1 - m.Column
+		}
+		if pos.CanPlay(m.Column) && m.Weight > 0 {
+			moves = append(moves, m)
+		}
+	}
+	sort.Slice(moves, func(i, j int) bool {
+		if moves[i].Weight != moves[j].Weight {
+			return moves[i].Weight > moves[j].Weight
+		}
+		return moves[i].Column < moves[j].Column
+	})
+	return moves
+}
+
+// Pick chooses one of pos's book moves at random, weighted. ok is false if
+// pos is not in the book.
+func (b *Book) Pick(pos *engine.Position) (column int, ok bool) {
+	moves := b.Moves(pos)
+	total := 0
+	for _, m := range moves {
+		total += m.Weight
+	}
+	if total == 0 {
+		return -1, false
+	}
+	n := rand.Intn(total)
+	for _, m := range moves {
+		if n < m.Weight {
+			return m.Column, true
+		}
+		n -= m.Weight
+	}
+	return -1, false
+}
+
+// canonical returns the key shared by pos and its mirror image, and
+// whether it is the mirror image's hash.
+func canonical(pos *engine.Position) (key uint64, mirrored bool) {
+	h := pos.Hash()
+	m := pos.Mirror()
+	if mh := m.Hash(); mh < h {
+		return mh, true
+	}
+	return h, false
+}
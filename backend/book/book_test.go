@@ -0,0 +1,66 @@
+package book
+
+import (
+	"reflect"
+	"testing"
+
+	"4-in-a-row/engine"
+)
+
+// positionAfter plays columns from the empty standard board.
+func positionAfter(t *testing.T, columns ...int) *engine.Position {
+	t.Helper()
+	pos, err := engine.New(6, 7, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range columns {
+		pos.Play(c)
+	}
+	return pos
+}
+
+func TestMirroredMoves(t *testing.T) {
+	pos := positionAfter(t, 0, 1)
+	mirror := positionAfter(t, 6, 5)
+
+	key, mirrored := canonical(pos)
+	mirrorKey, mirrorMirrored := canonical(mirror)
+	if key != mirrorKey || mirrored == mirrorMirrored {
+		t.Fatalf("canonical gives %x (mirrored %v) and %x (mirrored %v) for mirror images", key, mirrored, mirrorKey, mirrorMirrored)
+	}
+
+	b := New(6, 7, 4)
+	b.Add(pos, 2, 3)
+	b.Add(pos, 3, 1)
+	if b.Len() != 1 {
+		t.Fatalf("book holds %d positions, want 1", b.Len())
+	}
+	if got, want := b.Moves(mirror), []Move{{4, 3}, {3, 1}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("mirror's moves %v, want %v", got, want)
+	}
+
+	// Moves added on the mirror count for the original too
+	b.Add(mirror, 4, 2)
+	b.Add(mirror, 6, 1)
+	if got, want := b.Moves(pos), []Move{{2, 5}, {0, 1}, {3, 1}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("original's moves %v, want %v", got, want)
+	}
+	if got, want := b.Moves(mirror), []Move{{4, 5}, {3, 1}, {6, 1}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("mirror's moves %v, want %v", got, want)
+	}
+	if b.Len() != 1 {
+		t.Errorf("book holds %d positions, want 1", b.Len())
+	}
+
+	// A symmetric position is its own mirror
+	center := positionAfter(t, 3)
+	if _, mirrored := canonical(center); mirrored {
+		t.Error("symmetric position taken as mirrored")
+	}
+	b.Add(center, 2, 1)
+	b.Add(center, 4, 1)
+	if got, want := b.Moves(center), []Move{{2, 1}, {4, 1}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("symmetric position's moves %v, want %v", got, want)
+	}
+}
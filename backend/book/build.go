@@ -0,0 +1,160 @@
+package book
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"4-in-a-row/engine"
+	"4-in-a-row/models"
+	"4-in-a-row/notation"
+	"4-in-a-row/solver"
+)
+
+// Weights given to the moves of a recorded game.
+const (
+	winnerWeight = 2
+	drawWeight   = 1
+)
+
+// searchTolerance is how far below the best heuristic score a move may be
+// and still go in the book, so that near-equal moves add variety. Proven
+// results must match exactly.
+const searchTolerance = 3
+
+var ErrNotStandard = errors.New("opening books only cover the standard rules")
+
+// AddRecord adds the first plies moves of a finished game, weighting the
+// winner's moves, or both sides' moves after a draw. The loser's moves and
+// unfinished games are left out.
+func (b *Book) AddRecord(r *notation.Record, plies int) error {
+	if r.Options.Variant != models.VariantStandard {
+		return ErrNotStandard
+	}
+	if r.Options.Rows != b.rows || r.Options.Columns != b.columns || r.Options.WinLength != b.winLength {
+		return ErrWrongBoard
+	}
+	weights := map[int]int{}
+	switch r.Result {
+	case notation.ResultPlayer1:
+		weights[1] = winnerWeight
+	case notation.ResultPlayer2:
+		weights[2] = winnerWeight
+	case notation.ResultDraw:
+		weights[1], weights[2] = drawWeight, drawWeight
+	default:
+		return nil
+	}
+
+	pos, err := engine.New(b.rows, b.columns, b.winLength)
+	if err != nil {
+		return err
+	}
+	for i, m := range r.Moves {
+		if i >= plies || pos.Winner() != 0 {
+			break
+		}
+		if m.Kind == models.MovePop || !pos.CanPlay(m.Column) {
+			return fmt.Errorf("ply %d: illegal move", i+1)
+		}
+		if w := weights[pos.ToMove()]; w > 0 {
+			b.Add(pos, m.Column, w)
+		}
+		pos.Play(m.Column)
+	}
+	return nil
+}
+
+// AddSearch adds every position of fewer than plies moves, up to mirror
+// images, with the moves the solver rates best. Each move is searched
+// depth plies deep for at most think; positions it can prove are scored
+// exactly. progress, if not nil, is called after each position.
+func (b *Book) AddSearch(s *solver.Solver, plies, depth int, think time.Duration, progress func(done, total int)) error {
+	start, err := engine.New(b.rows, b.columns, b.winLength)
+	if err != nil {
+		return err
+	}
+
+	// Collect the positions breadth first, one per mirror pair.
+	seen := map[uint64]bool{}
+	level := []engine.Position{*start}
+	var todo []engine.Position
+	for ply := 0; ply < plies && len(level) > 0; ply++ {
+		var next []engine.Position
+		for _, pos := range level {
+			key, _ := canonical(&pos)
+			if seen[key] || pos.Winner() != 0 || pos.Full() {
+				continue
+			}
+			seen[key] = true
+			todo = append(todo, pos)
+			for col := 0; col < pos.Columns(); col++ {
+				if pos.CanPlay(col) {
+					child := pos
+					child.Play(col)
+					next = append(next, child)
+				}
+			}
+		}
+		level = next
+	}
+
+	for i := range todo {
+		if err := b.addBest(s, &todo[i], depth, think); err != nil {
+			return err
+		}
+		if progress != nil {
+			progress(i+1, len(todo))
+		}
+	}
+	return nil
+}
+
+// addBest adds the moves from pos whose value is within searchTolerance
+// of the best.
+func (b *Book) addBest(s *solver.Solver, pos *engine.Position, depth int, think time.Duration) error {
+	for col := 0; col < pos.Columns(); col++ {
+		if pos.CanPlay(col) && pos.IsWinningDrop(pos.ToMove(), col) {
+			return b.Add(pos, col, 1)
+		}
+	}
+
+	// Child results are from the opponent's point of view. Proven scores
+	// are scaled past any heuristic one so that all values compare.
+	const proven = 1 << 16
+	values := map[int]int{}
+	best := -1 << 31
+	for col := 0; col < pos.Columns(); col++ {
+		if !pos.CanPlay(col) {
+			continue
+		}
+		child := *pos
+		child.Play(col)
+		value := 0
+		if !child.Full() {
+			r, err := s.Search(&child, depth, time.Now().Add(think))
+			if err != nil {
+				return err
+			}
+			value = -r.Score
+			if r.Exact {
+				value *= proven
+			}
+		}
+		values[col] = value
+		best = max(best, value)
+	}
+
+	tolerance := searchTolerance
+	if best >= proven || best <= -proven {
+		tolerance = 0
+	}
+	for col, value := range values {
+		if value >= best-tolerance {
+			if err := b.Add(pos, col, 1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package book
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// Book files are little-endian:
+//
+//	magic "C4BK", version byte
+//	rows, columns, win length: one byte each
+//	position count: uint32
+//	per position, sorted by key:
+//	    key: uint64, move count: byte
+//	    per move: column byte, weight uint16
+//
+// A position with three moves takes 18 bytes.
+const (
+	magic   = "C4BK"
+	version = 1
+)
+
+var ErrBadFile = errors.New("not an opening book file")
+
+// Save writes the book to w.
+func (b *Book) Save(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(magic)
+	bw.Write([]byte{version, byte(b.rows), byte(b.columns), byte(b.winLength)})
+
+	keys := make([]uint64, 0, len(b.entries))
+	for k := range b.entries {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	var buf [8]byte
+	binary.LittleEndian.PutUint32(buf[:4], uint32(len(keys)))
+	bw.Write(buf[:4])
+	for _, k := range keys {
+		moves := b.entries[k]
+		binary.LittleEndian.PutUint64(buf[:], k)
+		bw.Write(buf[:])
+		bw.WriteByte(byte(len(moves)))
+		for _, m := range moves {
+			bw.WriteByte(byte(m.Column))
+			binary.LittleEndian.PutUint16(buf[:2], uint16(m.Weight))
+			bw.Write(buf[:2])
+		}
+	}
+	return bw.Flush()
+}
+
+// Load reads a book written by Save.
+func Load(r io.Reader) (*Book, error) {
+	br := bufio.NewReader(r)
+	var header [len(magic) + 4]byte
+	if _, err := io.ReadFull(br, header[:]); err != nil {
+		return nil, ErrBadFile
+	}
+	if string(header[:len(magic)]) != magic {
+		return nil, ErrBadFile
+	}
+	if header[len(magic)] != version {
+		return nil, fmt.Errorf("%w: version %d", ErrBadFile, header[len(magic)])
+	}
+	b := New(int(header[len(magic)+1]), int(header[len(magic)+2]), int(header[len(magic)+3]))
+
+	var count uint32
+	if err := binary.Read(br, binary.LittleEndian, &count); err != nil {
+		return nil, ErrBadFile
+	}
+	for i := uint32(0); i < count; i++ {
+		var key uint64
+		if err := binary.Read(br, binary.LittleEndian, &key); err != nil {
+			return nil, fmt.Errorf("%w: truncated", ErrBadFile)
+		}
+		n, err := br.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("%w: truncated", ErrBadFile)
+		}
+		moves := make([]Move, n)
+		for j := range moves {
+			var rec [3]byte
+			if _, err := io.ReadFull(br, rec[:]); err != nil {
+				return nil, fmt.Errorf("%w: truncated", ErrBadFile)
+			}
+			col := int(rec[0])
+			if col >= b.columns {
+				return nil, fmt.Errorf("%w: column %d out of range", ErrBadFile, col)
+			}
+			moves[j] = Move{Column: col, Weight: int(binary.LittleEndian.Uint16(rec[1:]))}
+		}
+		b.entries[key] = moves
+	}
+	return b, nil
+}
+
+// Open loads the book at path.
+func Open(path string) (*Book, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Load(f)
+}
+
+// WriteFile saves the book to path.
+func (b *Book) WriteFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := b.Save(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
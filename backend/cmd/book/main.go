@@ -0,0 +1,152 @@
+// Command book builds and inspects opening books for the bot.
+//
+//	go run ./cmd/book build -out book.bin -plies 8 games.pgn more.pgn
+//	go run ./cmd/book build -out book.bin -search-plies 4 -depth 12 -think 200ms
+//	go run ./cmd/book inspect book.bin
+//	go run ./cmd/book inspect -moves 4453 book.bin
+//
+// build reads PGN-like game records, such as the tournament command
+// writes, and can add the solver's best moves for every position of the
+// first few plies. Both sources can be combined in one book.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"4-in-a-row/book"
+	"4-in-a-row/engine"
+	"4-in-a-row/models"
+	"4-in-a-row/notation"
+	"4-in-a-row/solver"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	switch os.Args[1] {
+	case "build":
+		build(os.Args[2:])
+	case "inspect":
+		inspect(os.Args[2:])
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: book build [flags] [games.pgn ...]")
+	fmt.Fprintln(os.Stderr, "       book inspect [-moves sequence] book.bin")
+	os.Exit(2)
+}
+
+func build(args []string) {
+	fs := flag.NewFlagSet("build", flag.ExitOnError)
+	out := fs.String("out", "book.bin", "book file to write")
+	rows := fs.Int("rows", models.DefaultRows, "board rows")
+	columns := fs.Int("columns", models.DefaultColumns, "board columns")
+	winLength := fs.Int("win", models.DefaultWinLength, "discs in a row to win")
+	plies := fs.Int("plies", 8, "moves of each game to add")
+	searchPlies := fs.Int("search-plies", 0, "add solver moves for every position of fewer than this many plies")
+	depth := fs.Int("depth", 12, "solver search depth")
+	think := fs.Duration("think", 200*time.Millisecond, "solver time per move")
+	fs.Parse(args)
+
+	opts, err := models.GameOptions{Rows: *rows, Columns: *columns, WinLength: *winLength}.Normalize()
+	if err != nil {
+		fatalf("%v", err)
+	}
+	b := book.New(opts.Rows, opts.Columns, opts.WinLength)
+
+	for _, path := range fs.Args() {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		records, err := notation.ParsePGNs(string(data))
+		if err != nil {
+			fatalf("%s: %v", path, err)
+		}
+		added := 0
+		for i, r := range records {
+			switch err := b.AddRecord(r, *plies); err {
+			case nil:
+				added++
+			case book.ErrWrongBoard, book.ErrNotStandard:
+				// other boards and variants are skipped
+			default:
+				fatalf("%s: record %d: %v", path, i+1, err)
+			}
+		}
+		fmt.Fprintf(os.Stderr, "%s: %d of %d games added\n", path, added, len(records))
+	}
+
+	if *searchPlies > 0 {
+		s := solver.New(solver.DefaultTableBits)
+		err := b.AddSearch(s, *searchPlies, *depth, *think, func(done, total int) {
+			if done%50 == 0 || done == total {
+				fmt.Fprintf(os.Stderr, "searched %d/%d positions\n", done, total)
+			}
+		})
+		if err != nil {
+			fatalf("%v", err)
+		}
+	}
+
+	if err := b.WriteFile(*out); err != nil {
+		fatalf("%v", err)
+	}
+	fmt.Printf("wrote %s: %d positions\n", *out, b.Len())
+}
+
+func inspect(args []string) {
+	fs := flag.NewFlagSet("inspect", flag.ExitOnError)
+	moves := fs.String("moves", "", "show the book moves after this column sequence")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		usage()
+	}
+
+	b, err := book.Open(fs.Arg(0))
+	if err != nil {
+		fatalf("%v", err)
+	}
+	fmt.Printf("%dx%d board, %d in a row, %d positions\n", b.Rows(), b.Columns(), b.WinLength(), b.Len())
+
+	pos, err := engine.New(b.Rows(), b.Columns(), b.WinLength())
+	if err != nil {
+		fatalf("%v", err)
+	}
+	played, err := notation.ParseMoves(*moves, b.Columns())
+	if err != nil {
+		fatalf("%v", err)
+	}
+	for i, m := range played {
+		if m.Kind == models.MovePop || !pos.CanPlay(m.Column) || pos.Winner() != 0 {
+			fatalf("move %d is not legal", i+1)
+		}
+		pos.Play(m.Column)
+	}
+
+	entries := b.Moves(pos)
+	if len(entries) == 0 {
+		fmt.Printf("position %q is not in the book\n", *moves)
+		return
+	}
+	total := 0
+	for _, e := range entries {
+		total += e.Weight
+	}
+	fmt.Printf("position %q, player %d to move:\n", *moves, pos.ToMove())
+	for _, e := range entries {
+		fmt.Printf("  column %d  weight %5d  %5.1f%%\n", e.Column+1, e.Weight, 100*float64(e.Weight)/float64(total))
+	}
+}
+
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "book: "+format+"\n", args...)
+	os.Exit(1)
+}
@@ -0,0 +1,309 @@
+// Command tournament plays two bot strategies against each other and
+// reports how they compare. Games are driven through GameService directly,
+// with no server or WebSocket involved, and the strategies take turns
+// moving first.
+//
+//	go run ./cmd/tournament -a hard -b medium -games 1000
+//	go run ./cmd/tournament -a mcts -b "engine:python3 bots/mybot.py" -parallel 1 -out games.pgn
+//
+// A strategy is a built-in difficulty (easy, medium, hard, perfect, mcts)
+// or "engine:" followed by the command line of an external engine.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"4-in-a-row/book"
+	"4-in-a-row/models"
+	"4-in-a-row/notation"
+	"4-in-a-row/services"
+)
+
+// player is one side of the tournament.
+type player struct {
+	name       string
+	bot        services.Bot
+	difficulty string // for the built-in bot
+
+	mu        sync.Mutex
+	moves     int
+	thinking  time.Duration
+	forfeited int
+}
+
+// outcome is a finished game from player A's point of view.
+type outcome struct {
+	game   *models.Game
+	aFirst bool
+	score  float64 // 1 win, 0.5 draw, 0 loss
+}
+
+func main() {
+	aSpec := flag.String("a", "hard", "first strategy")
+	bSpec := flag.String("b", "medium", "second strategy")
+	games := flag.Int("games", 1000, "number of games")
+	parallel := flag.Int("parallel", runtime.NumCPU(), "games played at once")
+	moveTime := flag.Duration("movetime", 100*time.Millisecond, "think time per move for mcts and engines")
+	rows := flag.Int("rows", models.DefaultRows, "board rows")
+	columns := flag.Int("columns", models.DefaultColumns, "board columns")
+	winLength := flag.Int("win", models.DefaultWinLength, "discs in a row to win")
+	variant := flag.String("variant", models.VariantStandard, "standard or popout")
+	out := flag.String("out", "", "write the games to this file as PGN-like records")
+	bookPath := flag.String("book", "", "opening book for the built-in bots")
+	bookPlies := flag.Int("book-plies", 8, "plies to play from the opening book")
+	verbose := flag.Bool("v", false, "show bot logs")
+	flag.Parse()
+
+	if !*verbose {
+		log.SetOutput(io.Discard)
+	}
+	opts, err := models.GameOptions{Rows: *rows, Columns: *columns, WinLength: *winLength, Variant: *variant}.Normalize()
+	if err != nil {
+		fatalf("%v", err)
+	}
+	if *games < 1 || *parallel < 1 {
+		fatalf("-games and -parallel must be positive")
+	}
+
+	var openingBook *book.Book
+	if *bookPath != "" {
+		if openingBook, err = book.Open(*bookPath); err != nil {
+			fatalf("%v", err)
+		}
+	}
+
+	gs := services.NewGameService()
+	a, err := newPlayer(*aSpec, gs, *moveTime, *parallel, openingBook, *bookPlies)
+	if err != nil {
+		fatalf("-a: %v", err)
+	}
+	b, err := newPlayer(*bSpec, gs, *moveTime, *parallel, openingBook, *bookPlies)
+	if err != nil {
+		fatalf("-b: %v", err)
+	}
+	for _, p := range []*player{a, b} {
+		if eb, ok := p.bot.(*services.ExternalBot); ok {
+			defer eb.Close()
+		}
+	}
+
+	var w io.Writer
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	results := make(chan outcome)
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < *parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range jobs {
+				// A moves first in even games
+				results <- playGame(gs, a, b, n%2 == 0, opts)
+			}
+		}()
+	}
+	go func() {
+		for n := 0; n < *games; n++ {
+			jobs <- n
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+
+	var all []outcome
+	for o := range results {
+		all = append(all, o)
+		if w != nil {
+			fmt.Fprintln(w, notation.FromGame(o.game).String())
+		}
+		if len(all)%100 == 0 {
+			fmt.Fprintf(os.Stderr, "%d/%d games\n", len(all), *games)
+		}
+	}
+	report(os.Stdout, a, b, all)
+}
+
+// newPlayer builds the bot for a strategy spec. Engines get a process
+// for each game played at once.
+func newPlayer(spec string, gs *services.GameService, moveTime time.Duration, parallel int, openingBook *book.Book, bookPlies int) (*player, error) {
+	builtin := services.NewBotService(gs, moveTime)
+	if openingBook != nil {
+		builtin.SetBook(openingBook, bookPlies)
+	}
+	if command, ok := strings.CutPrefix(spec, "engine:"); ok {
+		args := strings.Fields(command)
+		if len(args) == 0 {
+			return nil, fmt.Errorf("missing engine command")
+		}
+		// The built-in bot only moves when the engine fails, which
+		// shows up in the logs with -v. At the default difficulty the
+		// engine thinks for exactly -movetime.
+		return &player{name: spec, bot: services.NewExternalBot(args, moveTime, parallel, builtin), difficulty: models.DefaultDifficulty}, nil
+	}
+	difficulty, err := models.NormalizeDifficulty(spec)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q", err, spec)
+	}
+	return &player{name: difficulty, bot: builtin, difficulty: difficulty}, nil
+}
+
+// playGame plays one game to the end. A player whose bot finds no move or
+// picks an illegal one loses the game.
+func playGame(gs *services.GameService, a, b *player, aFirst bool, opts models.GameOptions) outcome {
+	first, second, firstID, secondID := a, b, "a", "b"
+	if !aFirst {
+		first, second, firstID, secondID = b, a, "b", "a"
+	}
+	game, err := gs.CreateGame(firstID, first.name, secondID, second.name, false, opts)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	defer gs.DeleteGame(game.ID)
+
+	for game.Status == "active" {
+		p := first
+		if game.CurrentTurn == game.Player2ID {
+			p = second
+		}
+		game.Difficulty = p.difficulty
+		start := time.Now()
+		move := p.bot.MakeBotMove(game)
+		p.record(time.Since(start))
+
+		next, err := gs.PlayMove(game.ID, game.CurrentTurn, move)
+		if err != nil {
+			p.mu.Lock()
+			p.forfeited++
+			p.mu.Unlock()
+			if game, err = gs.Resign(game.ID, game.CurrentTurn); err != nil {
+				fatalf("%v", err)
+			}
+			break
+		}
+		game = next
+	}
+
+	o := outcome{game: game, aFirst: aFirst, score: 0.5}
+	switch game.Winner {
+	case "a":
+		o.score = 1
+	case "b":
+		o.score = 0
+	}
+	return o
+}
+
+func (p *player) record(d time.Duration) {
+	p.mu.Lock()
+	p.moves++
+	p.thinking += d
+	p.mu.Unlock()
+}
+
+// report prints the overall and per-side results, the Elo difference with
+// a 95% confidence interval, and the players' average move times.
+func report(w io.Writer, a, b *player, all []outcome) {
+	fmt.Fprintf(w, "%s vs %s, %d games\n\n", a.name, b.name, len(all))
+	fmt.Fprintf(w, "%-16s %6s %6s %6s %7s\n", "", "wins", "draws", "losses", "score")
+	printLine(w, "total", all, func(outcome) bool { return true })
+	printLine(w, a.name+" first", all, func(o outcome) bool { return o.aFirst })
+	printLine(w, b.name+" first", all, func(o outcome) bool { return !o.aFirst })
+
+	elo, low, high := eloInterval(all)
+	fmt.Fprintf(w, "\nElo difference: %s (95%% CI %s to %s)\n", formatElo(elo), formatElo(low), formatElo(high))
+
+	fmt.Fprintln(w)
+	for _, p := range []*player{a, b} {
+		avg := time.Duration(0)
+		if p.moves > 0 {
+			avg = p.thinking / time.Duration(p.moves)
+		}
+		fmt.Fprintf(w, "%s: %d moves, average %v per move", p.name, p.moves, avg.Round(time.Microsecond))
+		if p.forfeited > 0 {
+			fmt.Fprintf(w, ", %d games forfeited", p.forfeited)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+func printLine(w io.Writer, label string, all []outcome, keep func(outcome) bool) {
+	var wins, draws, losses int
+	for _, o := range all {
+		if !keep(o) {
+			continue
+		}
+		switch o.score {
+		case 1:
+			wins++
+		case 0:
+			losses++
+		default:
+			draws++
+		}
+	}
+	n := wins + draws + losses
+	if n == 0 {
+		return
+	}
+	score := (float64(wins) + float64(draws)/2) / float64(n)
+	fmt.Fprintf(w, "%-16s %6d %6d %6d %6.1f%%\n", label, wins, draws, losses, 100*score)
+}
+
+// eloInterval returns A's Elo advantage over B and a 95% confidence
+// interval for it, from the mean and standard error of A's game scores.
+func eloInterval(all []outcome) (elo, low, high float64) {
+	n := float64(len(all))
+	var sum, sumSq float64
+	for _, o := range all {
+		sum += o.score
+		sumSq += o.score * o.score
+	}
+	mean := sum / n
+	variance := sumSq/n - mean*mean
+	margin := 1.96 * math.Sqrt(variance/n)
+	return eloFromScore(mean), eloFromScore(mean - margin), eloFromScore(mean + margin)
+}
+
+// eloFromScore converts an expected score into a rating difference.
+func eloFromScore(score float64) float64 {
+	switch {
+	case score <= 0:
+		return math.Inf(-1)
+	case score >= 1:
+		return math.Inf(1)
+	}
+	return -400 * math.Log10(1/score-1)
+}
+
+func formatElo(elo float64) string {
+	if math.IsInf(elo, 0) {
+		if elo > 0 {
+			return "+inf"
+		}
+		return "-inf"
+	}
+	return fmt.Sprintf("%+.0f", elo)
+}
+
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "tournament: "+format+"\n", args...)
+	os.Exit(1)
+}
@@ -2,6 +2,8 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
@@ -12,6 +14,16 @@ type Config struct {
 	KafkaBrokers       []string
 	KafkaTopic         string
 	MatchmakingTimeout int
+	ReconnectGrace     int      // seconds a disconnected player has to rejoin
+	BotEngine          []string // external engine command; empty for the built-in bot
+	BotEngineProcesses int      // external engine processes, one per move being searched
+	BotMoveTimeMs      int      // think time per move for MCTS and external bots
+	BotBook            string   // opening book file; empty for none
+	BotBookPlies       int
+	ChatMaxLength      int    // characters per chat message
+	ChatPerMinute      int    // chat messages each player may send per minute
+	ChatFilterFile     string // word list for the chat filter; empty for none
+	RoomTimeout        int    // seconds a private room waits for its opponent
 }
 
 func Load() *Config {
@@ -29,6 +41,16 @@ func Load() *Config {
 		KafkaBrokers:       []string{getEnv("KAFKA_BROKERS", "localhost:9092")},
 		KafkaTopic:         getEnv("KAFKA_TOPIC", "game-events"),
 		MatchmakingTimeout: 10, // seconds
+		ReconnectGrace:     getEnvInt("RECONNECT_GRACE_SECONDS", 30),
+		BotEngine:          strings.Fields(os.Getenv("BOT_ENGINE")),
+		BotEngineProcesses: getEnvInt("BOT_ENGINE_PROCESSES", 4),
+		BotMoveTimeMs:      getEnvInt("BOT_MOVE_TIME_MS", 1000),
+		BotBook:            os.Getenv("BOT_BOOK"),
+		BotBookPlies:       getEnvInt("BOT_BOOK_PLIES", 8),
+		ChatMaxLength:      getEnvInt("CHAT_MAX_LENGTH", 200),
+		ChatPerMinute:      getEnvInt("CHAT_PER_MINUTE", 10),
+		ChatFilterFile:     os.Getenv("CHAT_FILTER_FILE"),
+		RoomTimeout:        getEnvInt("ROOM_TIMEOUT_SECONDS", 600),
 	}
 }
 
@@ -38,3 +60,10 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+func getEnvInt(key string, defaultValue int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil && value > 0 {
+		return value
+	}
+	return defaultValue
+}
@@ -0,0 +1,381 @@
+package engine
+
+import (
+	"errors"
+	"math/bits"
+)
+
+// MaxColumns bounds the per-column height table; the real limit on the
+// board is that (rows+1)*columns bits fit in a uint64.
+const MaxColumns = 16
+
+var ErrUnsupportedSize = errors.New("board size not supported by the engine")
+
+// Position is a Connect-N position stored as two bitboards. Each column
+// takes rows+1 consecutive bits, bottom cell first, with an always-empty
+// sentinel bit on top so that line shifts never wrap into the next
+// column. Position is a plain value: copying it clones the position.
+type Position struct {
+	rows      int
+	columns   int
+	winLength int
+	stride    int       // rows + 1
+	stones    [2]uint64 // stones[0] for player 1, stones[1] for player 2
+	heights   [MaxColumns]int8
+	toMove    int // 0 or 1
+	moves     int
+	winner    int    // 0 while nobody has a line, otherwise 1 or 2
+	bottom    uint64 // bottom cell of every column
+	full      uint64 // every playable cell, sentinels excluded
+}
+
+// New returns the empty position, player 1 to move.
+func New(rows, columns, winLength int) (*Position, error) {
+	if !Supports(rows, columns) || winLength < 1 || winLength > MaxColumns {
+		return nil, ErrUnsupportedSize
+	}
+	p := &Position{
+		rows:      rows,
+		columns:   columns,
+		winLength: winLength,
+		stride:    rows + 1,
+	}
+	col := (uint64(1) << uint(rows)) - 1
+	for c := 0; c < columns; c++ {
+		p.bottom |= p.bit(c, 0)
+		p.full |= col << uint(c*p.stride)
+	}
+	return p, nil
+}
+
+// Supports reports whether a rows x columns board fits in a bitboard.
+func Supports(rows, columns int) bool {
+	return rows > 0 && columns > 0 && columns <= MaxColumns && (rows+1)*columns <= 64
+}
+
+// FromBoard builds a position from a board of 0/1/2 cells, row 0 at the
+// top, with toMove (1 or 2) to play. Floating discs are rejected.
+func FromBoard(board [][]int, winLength, toMove int) (*Position, error) {
+	if len(board) == 0 {
+		return nil, ErrUnsupportedSize
+	}
+	p, err := New(len(board), len(board[0]), winLength)
+	if err != nil {
+		return nil, err
+	}
+	for col := 0; col < p.columns; col++ {
+		for row := p.rows - 1; row >= 0; row-- {
+			cell := board[row][col]
+			if cell == 0 {
+				continue
+			}
+			h := p.rows - 1 - row
+			if int(p.heights[col]) != h || (cell != 1 && cell != 2) {
+				return nil, errors.New("invalid board")
+			}
+			p.stones[cell-1] |= p.bit(col, h)
+			p.heights[col]++
+			p.moves++
+		}
+	}
+	p.toMove = toMove - 1
+	switch {
+	case p.hasLine(p.stones[0]):
+		p.winner = 1
+	case p.hasLine(p.stones[1]):
+		p.winner = 2
+	}
+	return p, nil
+}
+
+func (p *Position) Rows() int      { return p.rows }
+func (p *Position) Columns() int   { return p.columns }
+func (p *Position) WinLength() int { return p.winLength }
+
+// ToMove returns the player to move, 1 or 2.
+func (p *Position) ToMove() int { return p.toMove + 1 }
+
+// Moves returns the number of discs on the board.
+func (p *Position) Moves() int { return p.moves }
+
+// Winner returns the player with a completed line, or 0.
+func (p *Position) Winner() int { return p.winner }
+
+// Height returns the number of discs in column.
+func (p *Position) Height(column int) int { return int(p.heights[column]) }
+
+// Cell returns 0, 1 or 2 for the cell at row (0 is the top) and column.
+func (p *Position) Cell(row, column int) int {
+	b := p.bit(column, p.rows-1-row)
+	switch {
+	case p.stones[0]&b != 0:
+		return 1
+	case p.stones[1]&b != 0:
+		return 2
+	}
+	return 0
+}
+
+// Board returns the position as a rows x columns grid, row 0 at the top.
+func (p *Position) Board() [][]int {
+	board := make([][]int, p.rows)
+	for r := range board {
+		board[r] = make([]int, p.columns)
+		for c := range board[r] {
+			board[r][c] = p.Cell(r, c)
+		}
+	}
+	return board
+}
+
+// CanPlay reports whether a disc can be dropped into column.
+func (p *Position) CanPlay(column int) bool {
+	return column >= 0 && column < p.columns && int(p.heights[column]) < p.rows
+}
+
+// Play drops a disc for the player to move and returns the board row (0 is
+// the top) it landed in. The caller must check CanPlay first.
+func (p *Position) Play(column int) int {
+	h := int(p.heights[column])
+	b := p.bit(column, h)
+	p.stones[p.toMove] |= b
+	p.heights[column]++
+	p.moves++
+	if p.winner == 0 && p.lineThrough(p.stones[p.toMove], column, h) {
+		p.winner = p.toMove + 1
+	}
+	p.toMove ^= 1
+	return p.rows - 1 - h
+}
+
+// IsWinningDrop reports whether a disc of player (1 or 2) dropped into
+// column would complete a line. The caller must check CanPlay first.
+func (p *Position) IsWinningDrop(player, column int) bool {
+	h := int(p.heights[column])
+	return p.lineThrough(p.stones[player-1]|p.bit(column, h), column, h)
+}
+
+// CanPop reports whether the player to move owns the bottom disc of column.
+func (p *Position) CanPop(column int) bool {
+	return column >= 0 && column < p.columns && p.heights[column] > 0 &&
+		p.stones[p.toMove]&p.bit(column, 0) != 0
+}
+
+// Pop removes the mover's bottom disc of column and lets the column fall.
+// When the result has lines for both players the popper wins. The caller
+// must check CanPop first.
+func (p *Position) Pop(column int) {
+	shift := uint(column * p.stride)
+	colMask := ((uint64(1) << uint(p.stride)) - 1) << shift
+	for i := range p.stones {
+		s := p.stones[i]
+		p.stones[i] = s&^colMask | ((s&colMask)>>shift>>1)<<shift
+	}
+	p.heights[column]--
+	p.moves--
+	if p.winner == 0 {
+		switch {
+		case p.hasLine(p.stones[p.toMove]):
+			p.winner = p.toMove + 1
+		case p.hasLine(p.stones[p.toMove^1]):
+			p.winner = (p.toMove ^ 1) + 1
+		}
+	}
+	p.toMove ^= 1
+}
+
+// Mirror returns the position reflected left to right.
+func (p *Position) Mirror() Position {
+	m := *p
+	m.stones = [2]uint64{}
+	colMask := (uint64(1) << uint(p.stride)) - 1
+	for c := 0; c < p.columns; c++ {
+		from := uint(c * p.stride)
+		to := uint((p.columns - 1 - c) * p.stride)
+		for i := range p.stones {
+			m.stones[i] |= (p.stones[i] >> from & colMask) << to
+		}
+		m.heights[p.columns-1-c] = p.heights[c]
+	}
+	return m
+}
+
+// Stones returns player's (1 or 2) discs as a bitboard.
+func (p *Position) Stones(player int) uint64 { return p.stones[player-1] }
+
+// Mask returns all occupied cells as a bitboard.
+func (p *Position) Mask() uint64 { return p.stones[0] | p.stones[1] }
+
+// Possible returns the cells where the next disc of each non-full column
+// would land.
+func (p *Position) Possible() uint64 {
+	return (p.Mask() + p.bottomMask()) & p.boardMask()
+}
+
+// ColumnOf returns the column of a single-bit cell.
+func (p *Position) ColumnOf(cell uint64) int {
+	return bits.TrailingZeros64(cell) / p.stride
+}
+
+// WinningCells returns the empty cells that would complete a line for
+// player (1 or 2), whether or not they are playable yet.
+func (p *Position) WinningCells(player int) uint64 {
+	s := p.stones[player-1]
+	if p.winLength == 4 {
+		return p.winningCells4(s)
+	}
+	var r uint64
+	// A cell completes a line when it has j of the player's discs right
+	// behind it and winLength-1-j right ahead of it along a direction.
+	// ahead[k]/behind[k] mark cells followed/preceded by k such discs.
+	var ahead, behind [MaxColumns]uint64
+	ahead[0], behind[0] = ^uint64(0), ^uint64(0)
+	for _, d := range p.directions() {
+		for k := 1; k < p.winLength; k++ {
+			ahead[k] = ahead[k-1] & (s >> uint(k*d))
+			behind[k] = behind[k-1] & (s << uint(k*d))
+		}
+		for j := 0; j < p.winLength; j++ {
+			r |= behind[j] & ahead[p.winLength-1-j]
+		}
+	}
+	return r & p.full &^ p.Mask()
+}
+
+// winningCells4 is WinningCells unrolled for the usual four in a row,
+// which the solver calls at every node.
+func (p *Position) winningCells4(s uint64) uint64 {
+	// vertical: only three discs below can complete a line
+	r := (s << 1) & (s << 2) & (s << 3)
+	for _, d := range [3]uint{uint(p.stride), uint(p.stride - 1), uint(p.stride + 1)} {
+		t := (s << d) & (s << (2 * d))
+		r |= t & (s << (3 * d))
+		r |= t & (s >> d)
+		t = (s >> d) & (s >> (2 * d))
+		r |= t & (s << d)
+		r |= t & (s >> (3 * d))
+	}
+	return r & p.full &^ p.Mask()
+}
+
+// Cell is a board cell; row 0 is the top.
+type Cell struct {
+	Row, Column int
+}
+
+// Lines returns every line of player's (1 or 2) discs at least winLength
+// long. A longer run is one line with all of its cells. Lines are listed
+// by direction (vertical, horizontal, then the diagonals) and cells run
+// from the bottom or left end.
+func (p *Position) Lines(player int) [][]Cell {
+	s := p.stones[player-1]
+	var lines [][]Cell
+	for _, d := range p.directions() {
+		for rest := s; rest != 0; rest &= rest - 1 {
+			i := bits.TrailingZeros64(rest)
+			if i-d >= 0 && s&(uint64(1)<<uint(i-d)) != 0 {
+				continue // not the start of a run
+			}
+			n := 0
+			for j := i; j < 64 && s&(uint64(1)<<uint(j)) != 0; j += d {
+				n++
+			}
+			if n < p.winLength {
+				continue
+			}
+			line := make([]Cell, n)
+			for k := range line {
+				j := i + k*d
+				line[k] = Cell{Row: p.rows - 1 - j%p.stride, Column: j / p.stride}
+			}
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// HasLine reports whether player (1 or 2) has a completed line.
+func (p *Position) HasLine(player int) bool {
+	return p.hasLine(p.stones[player-1])
+}
+
+// Full reports whether every column is full.
+func (p *Position) Full() bool {
+	return p.moves == p.rows*p.columns
+}
+
+// Key encodes the position from the point of view of the player to move:
+// the mover's discs plus the occupancy mask plus the bottom row. It is
+// unique for a given board size and cheap enough for transposition tables.
+func (p *Position) Key() uint64 {
+	mask := p.stones[0] | p.stones[1]
+	return p.stones[p.toMove] + mask + p.bottomMask()
+}
+
+// Hash is a stable 64-bit hash of the position, including the board size
+// and the side to move. It does not change between runs or releases.
+func (p *Position) Hash() uint64 {
+	h := mix(uint64(p.rows)<<16 | uint64(p.columns)<<8 | uint64(p.winLength))
+	h = mix(h ^ p.stones[0])
+	h = mix(h ^ p.stones[1])
+	return mix(h ^ uint64(p.toMove))
+}
+
+func (p *Position) bit(column, height int) uint64 {
+	return uint64(1) << uint(column*p.stride+height)
+}
+
+// boardMask has every playable cell set, sentinels excluded.
+func (p *Position) boardMask() uint64 { return p.full }
+
+func (p *Position) bottomMask() uint64 { return p.bottom }
+
+// hasLine checks every line on the board at once by shifting the
+// bitboard along each direction.
+func (p *Position) hasLine(s uint64) bool {
+	for _, d := range p.directions() {
+		m := s
+		for i := 1; i < p.winLength && m != 0; i++ {
+			m &= s >> uint(i*d)
+		}
+		if m != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// lineThrough checks only the lines through the disc at column/height,
+// which is all a drop can complete.
+func (p *Position) lineThrough(s uint64, column, height int) bool {
+	pos := column*p.stride + height
+	for _, d := range p.directions() {
+		count := 1
+		for i := pos + d; i < 64 && s&(uint64(1)<<uint(i)) != 0; i += d {
+			count++
+		}
+		for i := pos - d; i >= 0 && s&(uint64(1)<<uint(i)) != 0; i -= d {
+			count++
+		}
+		if count >= p.winLength {
+			return true
+		}
+	}
+	return false
+}
+
+// directions are the bit distances between neighbours: vertical,
+// horizontal and the two diagonals.
+func (p *Position) directions() [4]int {
+	return [4]int{1, p.stride, p.stride + 1, p.stride - 1}
+}
+
+// mix is the splitmix64 finalizer.
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
@@ -0,0 +1,324 @@
+package engine
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// board parses a grid of '.', '1' and '2', top row first.
+func board(rows ...string) [][]int {
+	b := make([][]int, len(rows))
+	for r, row := range rows {
+		b[r] = make([]int, len(row))
+		for c, ch := range row {
+			if ch != '.' {
+				b[r][c] = int(ch - '0')
+			}
+		}
+	}
+	return b
+}
+
+// checkWin is the array scan the game service used before the bitboards,
+// kept as the reference for them.
+func checkWin(board [][]int, piece, winLength int) bool {
+	for row := range board {
+		for col := range board[row] {
+			if board[row][col] != piece {
+				continue
+			}
+			for _, d := range [4][2]int{{0, 1}, {1, 0}, {1, 1}, {1, -1}} {
+				n := 0
+				for r, c := row, col; r >= 0 && r < len(board) && c >= 0 && c < len(board[r]) && board[r][c] == piece; r, c = r+d[0], c+d[1] {
+					n++
+				}
+				if n >= winLength {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func TestWins(t *testing.T) {
+	tests := []struct {
+		name      string
+		board     [][]int
+		winLength int
+		toMove    int
+		column    int // the move that completes the line
+	}{
+		{
+			name:      "horizontal 5x4 N=3",
+			winLength: 3,
+			toMove:    1,
+			column:    0,
+			board: board(
+				"....",
+				"....",
+				"....",
+				".2..",
+				".112",
+			),
+		},
+		{
+			name:      "vertical 5x4 N=3",
+			winLength: 3,
+			toMove:    2,
+			column:    3,
+			board: board(
+				"....",
+				"....",
+				"....",
+				"1..2",
+				"11.2",
+			),
+		},
+		{
+			name:      "diagonal up-right 7x8 N=5",
+			winLength: 5,
+			toMove:    1,
+			column:    4,
+			board: board(
+				"........",
+				"........",
+				"........",
+				"...12...",
+				"..121...",
+				".1212...",
+				"12221...",
+			),
+		},
+		{
+			name:      "diagonal down-right 5x10 N=4",
+			winLength: 4,
+			toMove:    2,
+			column:    3,
+			board: board(
+				"..........",
+				"..........",
+				"...12.....",
+				"...112....",
+				"...2112...",
+			),
+		},
+		{
+			name:      "horizontal at the right edge 4x5 N=4",
+			winLength: 4,
+			toMove:    1,
+			column:    1,
+			board: board(
+				".....",
+				".....",
+				"..22.",
+				"2.111",
+			),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := FromBoard(tt.board, tt.winLength, tt.toMove)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.Winner() != 0 {
+				t.Fatalf("winner %d before the last move", p.Winner())
+			}
+			if !p.IsWinningDrop(tt.toMove, tt.column) {
+				t.Errorf("IsWinningDrop(%d, %d) = false", tt.toMove, tt.column)
+			}
+			if p.WinningCells(tt.toMove)&p.Possible()&p.columnMask(tt.column) == 0 {
+				t.Errorf("WinningCells misses column %d", tt.column)
+			}
+			p.Play(tt.column)
+			if p.Winner() != tt.toMove {
+				t.Errorf("winner %d after the move, want %d", p.Winner(), tt.toMove)
+			}
+			if !p.HasLine(tt.toMove) || len(p.Lines(tt.toMove)) != 1 {
+				t.Errorf("HasLine %v, %d lines", p.HasLine(tt.toMove), len(p.Lines(tt.toMove)))
+			}
+			if !checkWin(p.Board(), tt.toMove, tt.winLength) {
+				t.Error("checkWin disagrees")
+			}
+			q, err := FromBoard(p.Board(), tt.winLength, 3-tt.toMove)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if q.Winner() != tt.toMove {
+				t.Errorf("FromBoard winner %d, want %d", q.Winner(), tt.toMove)
+			}
+		})
+	}
+}
+
+// columnMask has the playable cells of column set.
+func (p *Position) columnMask(column int) uint64 {
+	return p.full & (((uint64(1) << uint(p.stride)) - 1) << uint(column*p.stride))
+}
+
+// TestSentinels checks that a run of discs at the end of one column does
+// not go on into the next: the sentinel bit between them breaks every
+// direction that crosses columns.
+func TestSentinels(t *testing.T) {
+	tests := []struct {
+		name  string
+		board [][]int
+	}{
+		{
+			// bits 2,3 of column 0 and 5,6 of column 1 would be four in a
+			// row without the sentinel at bit 4
+			name: "vertical",
+			board: board(
+				"1.",
+				"12",
+				"21",
+				"21",
+			),
+		},
+		{
+			// bits 0, 6 and 9 are three steps of 3 apart, but the step
+			// from bit 0 lands on the sentinel at bit 3
+			name: "diagonal down-right",
+			board: board(
+				".1.",
+				".21",
+				"122",
+			),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := FromBoard(tt.board, 3, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for player := 1; player <= 2; player++ {
+				if want := checkWin(tt.board, player, 3); p.HasLine(player) != want {
+					t.Errorf("HasLine(%d) = %v, want %v", player, !want, want)
+				}
+			}
+			sentinels := p.bottom << uint(p.rows)
+			if p.Mask()&sentinels != 0 {
+				t.Error("stones on sentinel bits")
+			}
+			if p.WinningCells(1)&sentinels != 0 || p.WinningCells(2)&sentinels != 0 {
+				t.Error("winning cells on sentinel bits")
+			}
+		})
+	}
+
+	p, _ := New(4, 3, 4)
+	for i := 0; i < 12; i++ {
+		p.Play(i % 3)
+	}
+	if p.Possible() != 0 {
+		t.Errorf("Possible() = %b on a full board", p.Possible())
+	}
+	if p.Mask() != p.full {
+		t.Errorf("Mask() = %b, want %b", p.Mask(), p.full)
+	}
+}
+
+// TestRandomGames plays random games on many board sizes and checks the
+// incremental winner against the array scan after every move.
+func TestRandomGames(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	sizes := [][3]int{{6, 7, 4}, {4, 4, 3}, {5, 4, 4}, {7, 8, 5}, {5, 10, 4}, {9, 6, 6}, {3, 15, 3}}
+	for _, size := range sizes {
+		for game := 0; game < 200; game++ {
+			p, err := New(size[0], size[1], size[2])
+			if err != nil {
+				t.Fatal(err)
+			}
+			for p.Winner() == 0 && !p.Full() {
+				col := rng.Intn(p.Columns())
+				if !p.CanPlay(col) {
+					continue
+				}
+				mover := p.ToMove()
+				want := p.IsWinningDrop(mover, col)
+				p.Play(col)
+				got := checkWin(p.Board(), mover, size[2])
+				if got != want || (p.Winner() == mover) != got {
+					t.Fatalf("%v: IsWinningDrop %v, Winner %d, checkWin %v\n%v", size, want, p.Winner(), got, p.Board())
+				}
+			}
+		}
+	}
+}
+
+func TestSupports(t *testing.T) {
+	tests := []struct {
+		rows, columns int
+		want          bool
+	}{
+		{6, 7, true},
+		{7, 8, true}, // 64 bits exactly
+		{8, 8, false},
+		{3, 16, true},
+		{1, 17, false},
+		{0, 7, false},
+	}
+	for _, tt := range tests {
+		if got := Supports(tt.rows, tt.columns); got != tt.want {
+			t.Errorf("Supports(%d, %d) = %v, want %v", tt.rows, tt.columns, got, tt.want)
+		}
+	}
+}
+
+// benchGames are random standard games, replayed by the benchmarks.
+func benchGames() [][]int {
+	rng := rand.New(rand.NewSource(1))
+	games := make([][]int, 64)
+	for i := range games {
+		p, _ := New(6, 7, 4)
+		for p.Winner() == 0 && !p.Full() {
+			col := rng.Intn(7)
+			if p.CanPlay(col) {
+				p.Play(col)
+				games[i] = append(games[i], col)
+			}
+		}
+	}
+	return games
+}
+
+// BenchmarkCheckWin replays games on a plain board, scanning it for a
+// line after every move as the game service used to.
+func BenchmarkCheckWin(b *testing.B) {
+	games := benchGames()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		moves := games[i%len(games)]
+		grid := make([][]int, 6)
+		for r := range grid {
+			grid[r] = make([]int, 7)
+		}
+		heights := make([]int, 7)
+		for ply, col := range moves {
+			piece := ply%2 + 1
+			heights[col]++
+			grid[6-heights[col]][col] = piece
+			if checkWin(grid, piece, 4) {
+				break
+			}
+		}
+	}
+}
+
+// BenchmarkPositionWinner replays the same games on a Position.
+func BenchmarkPositionWinner(b *testing.B) {
+	games := benchGames()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		moves := games[i%len(games)]
+		p, _ := New(6, 7, 4)
+		for _, col := range moves {
+			p.Play(col)
+			if p.Winner() != 0 {
+				break
+			}
+		}
+	}
+}
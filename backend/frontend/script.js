@@ -1,65 +1,302 @@
 let ws;
+let events;      // EventSource, when WebSockets don't get through
+let streamID;    // where to POST messages on the event stream
+let useEvents = false;
 let gameState;
 let playerID;
 let currentGame;
 let isPlayerOne = true;
+let leaving = false;
+
+// WebSocket protocol version, as a subprotocol
+const PROTOCOL = 'connect4.v1';
 
 function joinGame() {
+    const username = document.getElementById('username').value;
+    const difficulty = document.getElementById('difficulty').value;
+    if (!username) {
+        alert('Please enter username');
+        return;
+    }
+
+    connect({
+        type: 'join',
+        payload: { username: username, difficulty: difficulty }
+    });
+    document.getElementById('waiting-msg').style.display = 'block';
+}
+
+// Open a private room and wait for a friend to join with its code
+function createRoom() {
     const username = document.getElementById('username').value;
     if (!username) {
         alert('Please enter username');
         return;
     }
 
+    connect({
+        type: 'create-room',
+        payload: {
+            username: username,
+            first_move: document.getElementById('first-move').value,
+            unrated: document.getElementById('unrated').checked
+        }
+    });
+}
+
+function joinRoom() {
+    const username = document.getElementById('username').value;
+    const code = document.getElementById('room-code').value.trim();
+    if (!username || !code) {
+        alert('Please enter username and room code');
+        return;
+    }
+
+    connect({
+        type: 'join-room',
+        payload: { username: username, code: code }
+    });
+}
+
+function showRoomCode(room) {
+    const msg = document.getElementById('room-msg');
+    const expires = new Date(room.expires_at).toLocaleTimeString();
+    msg.textContent = `Room code: ${room.code} (share it with your friend; expires at ${expires})`;
+    msg.style.display = 'block';
+    document.getElementById('cancel-room').style.display = 'inline';
+}
+
+function hideRoomCode() {
+    document.getElementById('room-msg').style.display = 'none';
+    document.getElementById('cancel-room').style.display = 'none';
+}
+
+// Resume the game after a dropped connection or a page reload
+function rejoinGame() {
+    const token = sessionStorage.getItem('resumeToken');
+    if (token) {
+        connect({ type: 'rejoin', payload: { token: token } });
+    }
+}
+
+// Ask for the games in progress that can be watched
+function listGames() {
+    if (isConnected()) {
+        sendMessage({ type: 'list-games' });
+        return;
+    }
+    connect({ type: 'list-games' });
+}
+
+function watchGame(gameID) {
+    const username = document.getElementById('username').value;
+    sendMessage({ type: 'watch', payload: { game_id: gameID, username: username } });
+}
+
+function sendChat() {
+    const input = document.getElementById('chat-input');
+    const text = input.value.trim();
+    if (!text || !isConnected()) {
+        return;
+    }
+    sendMessage({ type: 'chat', payload: { text: text } });
+    input.value = '';
+}
+
+// Spectators see each other's chat; players never do
+function addChatLine(chat) {
+    const log = document.getElementById('chat-log');
+    const item = document.createElement('li');
+    if (chat.spectator) {
+        item.classList.add('spectator');
+    }
+    item.textContent = `${chat.name}: ${chat.text}`;
+    log.appendChild(item);
+    log.scrollTop = log.scrollHeight;
+}
+
+function renderChat(chat) {
+    document.getElementById('chat-log').innerHTML = '';
+    (chat || []).forEach(addChatLine);
+}
+
+function renderGameList(games) {
+    const list = document.getElementById('game-list');
+    list.innerHTML = '';
+    if (games.length === 0) {
+        list.textContent = 'No games in progress';
+        return;
+    }
+    games.forEach(game => {
+        const item = document.createElement('li');
+        item.textContent = `${game.player1_name} vs ${game.player2_name} (${game.moves} moves, ${game.spectators} watching) `;
+        const button = document.createElement('button');
+        button.textContent = 'Watch';
+        button.onclick = () => watchGame(game.id);
+        item.appendChild(button);
+        list.appendChild(item);
+    });
+}
+
+function connect(firstMessage) {
+    if (useEvents) {
+        connectEvents(firstMessage);
+        return;
+    }
+
     // Connect to WebSocket
     const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
-    ws = new WebSocket(`${protocol}//${window.location.host}/ws`);
+    ws = new WebSocket(`${protocol}//${window.location.host}/ws`, [PROTOCOL]);
+    let opened = false;
 
     ws.onopen = () => {
-        ws.send(JSON.stringify({
-            type: 'join',
-            payload: { username: username }
-        }));
+        opened = true;
+        ws.send(JSON.stringify(firstMessage));
+    };
 
-        document.getElementById('waiting-msg').style.display = 'block';
+    ws.onclose = () => {
+        // The upgrade never got through, e.g. behind a proxy
+        if (!opened && !leaving) {
+            console.warn('WebSocket unavailable, falling back to Server-Sent Events');
+            useEvents = true;
+            connectEvents(firstMessage);
+            return;
+        }
+        connectionLost();
     };
 
     ws.onmessage = (event) => {
-        const msg = JSON.parse(event.data);
-        console.log('Received message:', msg);
-
-        if (msg.type === 'game-state') {
-            gameState = msg.payload.game;
-            playerID = msg.payload.player_id;  // Get player ID from server!
-            isPlayerOne = (playerID === gameState.player1_id);
-            currentGame = msg.payload;
-
-            console.log('Player ID:', playerID);
-            console.log('Is Player One:', isPlayerOne);
-
-            if (gameState.status === 'active') {
-                document.getElementById('waiting-msg').style.display = 'none';
-                showGameScreen();
-                renderBoard();
-                updateGameInfo();
-            } else {
-                showGameEndScreen();
-            }
-        }
+        handleMessage(JSON.parse(event.data));
     };
 
     ws.onerror = (error) => {
         console.error('WebSocket error:', error);
-        alert('Connection error');
+        if (opened) {
+            alert('Connection error');
+        }
+    };
+}
+
+// Server-Sent Events fallback: updates arrive on the event stream and
+// messages are POSTed to it
+function connectEvents(firstMessage) {
+    events = new EventSource(`/events?protocol=${PROTOCOL}`);
+
+    events.onmessage = (event) => {
+        const msg = JSON.parse(event.data);
+        if (msg.type === 'hello') {
+            streamID = msg.payload.stream;
+            sendMessage(firstMessage);
+        }
+        handleMessage(msg);
+    };
+
+    events.onerror = () => {
+        // A new stream would be a new connection, so start over with a rejoin
+        events.close();
+        events = null;
+        streamID = null;
+        connectionLost();
     };
 }
 
+function connectionLost() {
+    if (!leaving && gameState && gameState.status === 'active') {
+        setTimeout(rejoinGame, 1000);
+    }
+}
+
+function isConnected() {
+    if (useEvents) {
+        return events && streamID && events.readyState === EventSource.OPEN;
+    }
+    return ws && ws.readyState === WebSocket.OPEN;
+}
+
+function sendMessage(msg) {
+    if (useEvents) {
+        return fetch(`/events/${streamID}`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify(msg)
+        });
+    }
+    ws.send(JSON.stringify(msg));
+    return Promise.resolve();
+}
+
+function closeConnection() {
+    if (ws) {
+        ws.close();
+    }
+    if (events) {
+        events.close();
+    }
+}
+
+function handleMessage(msg) {
+    console.log('Received message:', msg);
+
+    if (msg.type === 'error') {
+        console.warn('Server error:', msg.payload.code, msg.payload.error);
+        if (msg.payload.code === 'INVALID_RESUME_TOKEN' || msg.payload.code === 'GAME_NOT_FOUND') {
+            sessionStorage.removeItem('resumeToken');
+        }
+        if (msg.payload.code === 'ROOM_NOT_FOUND' || msg.payload.code === 'ROOM_EXPIRED') {
+            hideRoomCode();
+            alert(msg.payload.error);
+        }
+    }
+
+    if (msg.type === 'room-created') {
+        showRoomCode(msg.payload);
+    }
+
+    if (msg.type === 'room-cancelled') {
+        hideRoomCode();
+    }
+
+    if (msg.type === 'chat') {
+        addChatLine(msg.payload);
+    }
+
+    if (msg.type === 'game-list') {
+        renderGameList(msg.payload.games || []);
+    }
+
+    if (msg.type === 'game-state') {
+        if (msg.payload.resume_token) {
+            sessionStorage.setItem('resumeToken', msg.payload.resume_token);
+        }
+        gameState = msg.payload.game;
+        playerID = msg.payload.player_id;  // Get player ID from server!
+        isPlayerOne = (playerID === gameState.player1_id);
+        currentGame = msg.payload;
+
+        console.log('Player ID:', playerID);
+        console.log('Is Player One:', isPlayerOne);
+
+        if (gameState.status === 'active') {
+            document.getElementById('waiting-msg').style.display = 'none';
+            showGameScreen();
+            renderBoard();
+            renderChat(gameState.chat);
+            updateGameInfo();
+        } else {
+            sessionStorage.removeItem('resumeToken');
+            showGameEndScreen();
+        }
+        updateSeries();
+        updateRematch();
+    }
+}
+
 function makeMove(column) {
     console.log('========== makeMove START ==========');
     console.log('Column:', column);
     console.log('gameState:', gameState);
     console.log('playerID:', playerID);
-    console.log('WebSocket state:', ws ? ws.readyState : 'no ws', 'Open=', WebSocket.OPEN);
+    console.log('Connected:', isConnected(), useEvents ? '(event stream)' : '(WebSocket)');
 
     if (!gameState) {
         console.error('ERROR: gameState is null!');
@@ -67,12 +304,17 @@ function makeMove(column) {
         return;
     }
 
-    if (!ws || ws.readyState !== WebSocket.OPEN) {
-        console.error('ERROR: WebSocket not open');
+    if (!isConnected()) {
+        console.error('ERROR: not connected');
         alert('Connection lost!');
         return;
     }
 
+    if (!playerID) {
+        alert('Spectators cannot play');
+        return;
+    }
+
     if (gameState.current_turn !== playerID) {
         console.error('ERROR: Not your turn. Current turn:', gameState.current_turn, 'Player ID:', playerID);
         alert('Not your turn!');
@@ -81,7 +323,7 @@ function makeMove(column) {
 
     // Find the row where the piece will land
     let landRow = -1;
-    for (let row = 5; row >= 0; row--) {
+    for (let row = gameState.rows - 1; row >= 0; row--) {
         if (gameState.board[row][column] === 0) {
             landRow = row;
             break;
@@ -116,7 +358,7 @@ function makeMove(column) {
     };
 
     console.log('Sending move:', moveMsg);
-    ws.send(JSON.stringify(moveMsg));
+    sendMessage(moveMsg);
     console.log('Move sent!');
     console.log('========== makeMove END ==========');
 }
@@ -124,11 +366,18 @@ function makeMove(column) {
 function renderBoard() {
     const grid = document.getElementById('grid');
     grid.innerHTML = '';
+    grid.style.gridTemplateColumns = `repeat(${gameState.columns}, 60px)`;
 
     console.log('Rendering board, gameState:', gameState);
 
-    for (let row = 0; row < 6; row++) {
-        for (let col = 0; col < 7; col++) {
+    // Cells of the winning lines, as reported by the server
+    const winning = new Set();
+    (gameState.winning_lines || []).forEach(line => {
+        line.forEach(c => winning.add(c.row + ',' + c.column));
+    });
+
+    for (let row = 0; row < gameState.rows; row++) {
+        for (let col = 0; col < gameState.columns; col++) {
             const cell = document.createElement('div');
             cell.className = 'cell';
             cell.dataset.col = col;
@@ -144,6 +393,9 @@ function renderBoard() {
                 cell.classList.add('player2');
                 cell.textContent = '🔴';
             }
+            if (winning.has(row + ',' + col)) {
+                cell.classList.add('winning');
+            }
 
             // Add click handler to entire grid
             cell.addEventListener('click', (e) => {
@@ -161,6 +413,7 @@ function renderBoard() {
 
 function updateGameInfo() {
     document.getElementById('player-name').textContent = gameState.player1_name;
+    document.getElementById('spectators').textContent = currentGame.spectators || 0;
     document.getElementById('current-turn').textContent =
         gameState.current_turn === gameState.player1_id ? 'Your Turn' : 'Opponent\'s Turn';
 
@@ -172,6 +425,31 @@ function updateGameInfo() {
     }
 }
 
+// Running score of a series of rematches, if this game is part of one
+function updateSeries() {
+    const series = document.getElementById('series');
+    const score = currentGame.series;
+    if (!score) {
+        series.style.display = 'none';
+        return;
+    }
+    const wins = id => score.wins[id] || 0;
+    series.textContent = `Series: ${gameState.player1_name} ${wins(gameState.player1_id)} - ` +
+        `${wins(gameState.player2_id)} ${gameState.player2_name}` +
+        (score.draws ? ` (${score.draws} drawn)` : '');
+    series.style.display = 'block';
+}
+
+// Finished games can be rematched, with colors swapped
+function updateRematch() {
+    const over = gameState.status !== 'active' && playerID && !gameState.rematch_id;
+    const offeredBy = gameState.rematch_offered_by;
+    document.getElementById('rematch').style.display = over ? 'inline' : 'none';
+    document.getElementById('rematch-offer').style.display = offeredBy ? 'none' : 'inline';
+    document.getElementById('rematch-answer').style.display =
+        offeredBy && offeredBy !== playerID ? 'inline' : 'none';
+}
+
 function showGameScreen() {
     document.getElementById('login-screen').classList.remove('active');
     document.getElementById('game-screen').classList.add('active');
@@ -183,14 +461,21 @@ function showGameEndScreen() {
 }
 
 function leaveGame() {
-    if (ws) {
-        ws.send(JSON.stringify({ type: 'leave' }));
-        ws.close();
+    leaving = true;
+    sessionStorage.removeItem('resumeToken');
+    if (!isConnected()) {
+        location.reload();
+        return;
     }
-    location.reload();
+    sendMessage({ type: 'leave' }).finally(() => {
+        closeConnection();
+        location.reload();
+    });
 }
 
 function backToGame() {
     document.getElementById('leaderboard-screen').classList.remove('active');
     document.getElementById('game-screen').classList.add('active');
 }
+
+rejoinGame();
@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"4-in-a-row/models"
+	"4-in-a-row/services"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+)
+
+// maxRequestBody caps REST API request bodies.
+const maxRequestBody = 4096
+
+// gameStatuses are the values accepted by the games list's status filter.
+var gameStatuses = map[string]bool{
+	"active": true, "won": true, "draw": true, "timeout": true,
+	"resigned": true, "agreed-draw": true, "abandoned": true,
+}
+
+// APIHandler serves the JSON REST API. It shares the game, matchmaking
+// and session services with the WebSocket handler.
+type APIHandler struct {
+	gameService  *services.GameService
+	matchService *services.MatchmakingService
+	sessions     *services.SessionService
+	onMove       func(game *models.Game, playerID string, move models.MovePayload)
+	mu           sync.RWMutex
+}
+
+type gameListResponse struct {
+	Games []*models.Game `json:"games"`
+}
+
+func NewAPIHandler(gs *services.GameService, ms *services.MatchmakingService, ss *services.SessionService) *APIHandler {
+	return &APIHandler{
+		gameService:  gs,
+		matchService: ms,
+		sessions:     ss,
+	}
+}
+
+// SetMoveHandler registers fn to be called after a move is played through
+// the API, so that the players' connections hear about it.
+func (ah *APIHandler) SetMoveHandler(fn func(game *models.Game, playerID string, move models.MovePayload)) {
+	ah.mu.Lock()
+	defer ah.mu.Unlock()
+	ah.onMove = fn
+}
+
+// Register adds the API routes to router under /api.
+func (ah *APIHandler) Register(router *mux.Router) {
+	api := router.PathPrefix("/api").Subrouter()
+	api.HandleFunc("/games", ah.ListGames).Methods(http.MethodGet)
+	api.HandleFunc("/games/{id}", ah.GetGame).Methods(http.MethodGet)
+	api.HandleFunc("/games/{id}/moves", ah.PlayMove).Methods(http.MethodPost)
+	api.HandleFunc("/players/{id}", ah.GetPlayer).Methods(http.MethodGet)
+}
+
+// ListGames handles GET /api/games, optionally filtered with ?status=.
+// Games in private rooms are left out, as in the WebSocket game list.
+func (ah *APIHandler) ListGames(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status != "" && !gameStatuses[status] {
+		writeAPIError(w, ErrInvalidStatus)
+		return
+	}
+	games := ah.gameService.Games(func(game *models.Game) bool {
+		return !game.Private && (status == "" || game.Status == status)
+	})
+	views := make([]*models.Game, len(games))
+	for i, game := range games {
+		views[i] = game.PlayerView()
+	}
+	writeJSON(w, http.StatusOK, gameListResponse{Games: views})
+}
+
+// GetGame handles GET /api/games/{id}. Like every game the API returns,
+// it is the players' view, without the spectators' chat. A game in a
+// private room is only shown to its players, who authenticate with their
+// resume token as for moves; anyone else is told it does not exist.
+func (ah *APIHandler) GetGame(w http.ResponseWriter, r *http.Request) {
+	game, err := ah.gameService.GetGame(mux.Vars(r)["id"])
+	if err == nil && game.Private && !ah.isPlayer(r, game.ID) {
+		err = services.ErrGameNotFound
+	}
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, game.PlayerView())
+}
+
+// isPlayer reports whether the request carries the resume token of a
+// player in the game.
+func (ah *APIHandler) isPlayer(r *http.Request, gameID string) bool {
+	token, ok := bearerToken(r)
+	if !ok {
+		return false
+	}
+	_, sessionGame, err := ah.sessions.Lookup(token)
+	return err == nil && sessionGame == gameID
+}
+
+// PlayMove handles POST /api/games/{id}/moves. Players authenticate with
+// the resume token of their seat as a bearer token, and the body is a move
+// payload as sent over the WebSocket.
+func (ah *APIHandler) PlayMove(w http.ResponseWriter, r *http.Request) {
+	gameID := mux.Vars(r)["id"]
+	token, ok := bearerToken(r)
+	if !ok {
+		writeAPIError(w, ErrUnauthorized)
+		return
+	}
+	playerID, sessionGame, err := ah.sessions.Lookup(token)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	if sessionGame != gameID {
+		writeAPIError(w, services.ErrNotInGame)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBody))
+	if err != nil {
+		writeAPIError(w, models.ErrInvalidPayload)
+		return
+	}
+	var move models.MovePayload
+	if err := models.DecodePayload(body, &move); err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	game, err := ah.gameService.PlayMove(gameID, playerID, move)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	ah.mu.RLock()
+	onMove := ah.onMove
+	ah.mu.RUnlock()
+	if onMove != nil {
+		onMove(game, playerID, move)
+	}
+	writeJSON(w, http.StatusOK, game.PlayerView())
+}
+
+// GetPlayer handles GET /api/players/{id}, with the player's record over
+// the games the server still holds.
+func (ah *APIHandler) GetPlayer(w http.ResponseWriter, r *http.Request) {
+	playerID := mux.Vars(r)["id"]
+	player, activeGame, found := ah.gameService.PlayerRecord(playerID)
+	name, waiting := ah.matchService.Waiting(playerID)
+	if !found && !waiting {
+		writeAPIError(w, ErrPlayerNotFound)
+		return
+	}
+	if !found {
+		player = models.Player{ID: playerID, Username: name}
+	}
+	writeJSON(w, http.StatusOK, models.PlayerStatus{
+		Player:     player,
+		Waiting:    waiting,
+		ActiveGame: activeGame,
+	})
+}
+
+// bearerToken returns the token of an "Authorization: Bearer" header.
+func bearerToken(r *http.Request) (string, bool) {
+	const prefix = "Bearer "
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, prefix) || len(auth) == len(prefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(auth, prefix), true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error writing API response: %v\n", err)
+	}
+}
+
+// writeAPIError writes err with its protocol error code and matching HTTP
+// status.
+func writeAPIError(w http.ResponseWriter, err error) {
+	writeJSON(w, httpStatus(err), models.ErrorPayload{
+		Code:  errorCode(err),
+		Error: err.Error(),
+	})
+}
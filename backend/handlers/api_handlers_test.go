@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"4-in-a-row/models"
+	"4-in-a-row/services"
+
+	"github.com/gorilla/mux"
+)
+
+type apiTest struct {
+	t        *testing.T
+	router   *mux.Router
+	games    *services.GameService
+	sessions *services.SessionService
+	moves    int // moves passed to the move handler
+}
+
+func newAPITest(t *testing.T) *apiTest {
+	gs := services.NewGameService()
+	ss := services.NewSessionService(time.Minute)
+	at := &apiTest{t: t, router: mux.NewRouter(), games: gs, sessions: ss}
+	ah := NewAPIHandler(gs, services.NewMatchmakingService(10), ss)
+	ah.SetMoveHandler(func(*models.Game, string, models.MovePayload) { at.moves++ })
+	ah.Register(at.router)
+	return at
+}
+
+// do serves a request and decodes the response body into v, if given.
+func (at *apiTest) do(method, path, token, body string, v interface{}) int {
+	at.t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	rec := httptest.NewRecorder()
+	at.router.ServeHTTP(rec, req)
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		at.t.Errorf("%s %s: content type %q", method, path, ct)
+	}
+	if v != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			at.t.Errorf("%s %s: %v in %s", method, path, err, rec.Body)
+		}
+	}
+	return rec.Code
+}
+
+// expectError checks a request's status and error code.
+func (at *apiTest) expectError(method, path, token, body string, status int, code string) {
+	at.t.Helper()
+	var e models.ErrorPayload
+	if got := at.do(method, path, token, body, &e); got != status || e.Code != code {
+		at.t.Errorf("%s %s: %d %s, want %d %s", method, path, got, e.Code, status, code)
+	}
+}
+
+func TestAPIGames(t *testing.T) {
+	at := newAPITest(t)
+	var list gameListResponse
+	if status := at.do(http.MethodGet, "/api/games", "", "", &list); status != http.StatusOK || list.Games == nil || len(list.Games) != 0 {
+		t.Errorf("empty list: %d %+v", status, list)
+	}
+
+	game, err := at.games.CreateGame("a", "alice", "b", "bob", false, models.GameOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	at.games.AddChat(game.ID, models.ChatMessage{From: "a", Name: "alice", Text: "gl"})
+	at.games.AddChat(game.ID, models.ChatMessage{Name: "eve", Text: "play 4!", Spectator: true})
+
+	var got models.Game
+	if status := at.do(http.MethodGet, "/api/games/"+game.ID, "", "", &got); status != http.StatusOK || got.ID != game.ID {
+		t.Fatalf("GET game: %d %+v", status, got)
+	}
+	if len(got.Chat) != 1 || got.Chat[0].Spectator {
+		t.Errorf("GET game shows chat %+v, want the players' only", got.Chat)
+	}
+
+	for status, want := range map[string]int{"active": 1, "won": 0} {
+		list = gameListResponse{}
+		at.do(http.MethodGet, "/api/games?status="+status, "", "", &list)
+		if len(list.Games) != want {
+			t.Errorf("status=%s: %d games, want %d", status, len(list.Games), want)
+		}
+		for _, g := range list.Games {
+			if len(g.Chat) != 1 {
+				t.Errorf("listed game shows chat %+v", g.Chat)
+			}
+		}
+	}
+
+	at.expectError(http.MethodGet, "/api/games?status=paused", "", "", http.StatusBadRequest, models.ErrCodeInvalidQuery)
+	at.expectError(http.MethodGet, "/api/games/nope", "", "", http.StatusNotFound, models.ErrCodeGameNotFound)
+}
+
+// TestAPIPrivateGames checks that games in private rooms are never listed
+// and are only shown to their players.
+func TestAPIPrivateGames(t *testing.T) {
+	at := newAPITest(t)
+	gs, ss := at.games, at.sessions
+
+	private := models.NewGame("private", "a", "alice", "b", "bob", false, models.DefaultGameOptions())
+	private.Private = true
+	if _, err := gs.StoreGame(private); err != nil {
+		t.Fatal(err)
+	}
+	public, _ := gs.CreateGame("c", "carol", "d", "dave", false, models.GameOptions{})
+	alice := "Bearer " + ss.Create("a", private.ID)
+	carol := "Bearer " + ss.Create("c", public.ID)
+
+	for _, query := range []string{"", "?status=active"} {
+		var list gameListResponse
+		at.do(http.MethodGet, "/api/games"+query, alice, "", &list)
+		if len(list.Games) != 1 || list.Games[0].ID != public.ID {
+			t.Errorf("games%s lists %d games, want only the public one", query, len(list.Games))
+		}
+	}
+
+	path := "/api/games/" + private.ID
+	at.expectError(http.MethodGet, path, "", "", http.StatusNotFound, models.ErrCodeGameNotFound)
+	at.expectError(http.MethodGet, path, "Bearer nope", "", http.StatusNotFound, models.ErrCodeGameNotFound)
+	at.expectError(http.MethodGet, path, carol, "", http.StatusNotFound, models.ErrCodeGameNotFound)
+	var got models.Game
+	if status := at.do(http.MethodGet, path, alice, "", &got); status != http.StatusOK || got.ID != private.ID {
+		t.Errorf("GET private game as a player: %d %s", status, got.ID)
+	}
+}
+
+func TestAPIPlayMove(t *testing.T) {
+	at := newAPITest(t)
+	gs, ss := at.games, at.sessions
+
+	game, _ := gs.CreateGame("a", "alice", "b", "bob", false, models.GameOptions{})
+	other, _ := gs.CreateGame("c", "carol", "d", "dave", false, models.GameOptions{})
+	alice := "Bearer " + ss.Create("a", game.ID)
+	bob := "Bearer " + ss.Create("b", game.ID)
+	carol := "Bearer " + ss.Create("c", other.ID)
+	path := "/api/games/" + game.ID + "/moves"
+
+	at.expectError(http.MethodPost, path, "", `{"column":3}`, http.StatusUnauthorized, models.ErrCodeUnauthorized)
+	at.expectError(http.MethodPost, path, "Bearer ", `{"column":3}`, http.StatusUnauthorized, models.ErrCodeUnauthorized)
+	at.expectError(http.MethodPost, path, "Basic "+alice[7:], `{"column":3}`, http.StatusUnauthorized, models.ErrCodeUnauthorized)
+	at.expectError(http.MethodPost, path, "Bearer nope", `{"column":3}`, http.StatusUnauthorized, models.ErrCodeInvalidResumeToken)
+	at.expectError(http.MethodPost, path, carol, `{"column":3}`, http.StatusForbidden, models.ErrCodeNotInGame)
+	at.expectError(http.MethodPost, path, bob, `{"column":3}`, http.StatusConflict, models.ErrCodeNotYourTurn)
+	at.expectError(http.MethodPost, path, alice, `{"column":3,"row":0}`, http.StatusBadRequest, models.ErrCodeInvalidPayload)
+	at.expectError(http.MethodPost, path, alice, `{"column":9}`, http.StatusBadRequest, models.ErrCodeInvalidColumn)
+	at.expectError(http.MethodPost, path, alice, `{"column":3,"kind":"pop"}`, http.StatusConflict, models.ErrCodePopNotAllowed)
+	if at.moves != 0 {
+		t.Fatalf("move handler called %d times for rejected moves", at.moves)
+	}
+
+	var got models.Game
+	if status := at.do(http.MethodPost, path, alice, `{"column":3}`, &got); status != http.StatusOK {
+		t.Fatalf("move: status %d", status)
+	}
+	if len(got.Moves) != 1 || got.CurrentTurn != "b" || at.moves != 1 {
+		t.Errorf("after the move: %d moves, %s to move, handler called %d times", len(got.Moves), got.CurrentTurn, at.moves)
+	}
+
+	gs.Resign(game.ID, "a")
+	at.expectError(http.MethodPost, path, bob, `{"column":3}`, http.StatusConflict, models.ErrCodeGameNotActive)
+}
+
+func TestAPIPlayer(t *testing.T) {
+	at := newAPITest(t)
+	game, _ := at.games.CreateGame("a", "alice", "b", "bob", false, models.GameOptions{})
+
+	var player models.PlayerStatus
+	if status := at.do(http.MethodGet, "/api/players/a", "", "", &player); status != http.StatusOK {
+		t.Fatalf("status %d", status)
+	}
+	if player.Username != "alice" || player.ActiveGame != game.ID || player.Waiting {
+		t.Errorf("got %+v", player)
+	}
+	at.expectError(http.MethodGet, "/api/players/nobody", "", "", http.StatusNotFound, models.ErrCodePlayerNotFound)
+}
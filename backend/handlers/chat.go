@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"4-in-a-row/models"
+	"net"
+	"time"
+)
+
+// botChatDelay is how long the bot takes to answer a chat line.
+const botChatDelay = 1 * time.Second
+
+// chatSender is the key a client's chat is rate limited by: the player,
+// who keeps their ID when resuming, or else the spectator's address, so
+// that a new connection doesn't get a new allowance.
+func chatSender(cs *connState) string {
+	if cs.playerID != "" {
+		return cs.playerID
+	}
+	host, _, err := net.SplitHostPort(cs.client.addr)
+	if err != nil {
+		return cs.client.addr
+	}
+	return host
+}
+
+// playerChat sends a player's chat line to both players and the game's
+// spectators. In bot games the bot may answer.
+func (gh *GameHandler) playerChat(cs *connState, text string) {
+	game, err := gh.gameService.GetGame(cs.game())
+	if err != nil {
+		gh.sendError(cs.client, err)
+		return
+	}
+	text, err = gh.chat.Prepare(chatSender(cs), text)
+	if err != nil {
+		gh.sendError(cs.client, err)
+		return
+	}
+	name := game.Player1Name
+	if cs.playerID == game.Player2ID {
+		name = game.Player2Name
+	}
+	msg := models.ChatMessage{From: cs.playerID, Name: name, Text: text, SentAt: time.Now()}
+	if err := gh.gameService.AddChat(game.ID, msg); err != nil {
+		gh.sendError(cs.client, err)
+		return
+	}
+	gh.sendChat(game, msg)
+
+	if game.IsBot {
+		go func() {
+			reply, ok := gh.chat.BotReply(game.ID, text)
+			if !ok {
+				return
+			}
+			time.Sleep(botChatDelay)
+			botName := game.Player2Name
+			if game.Player1ID == "bot" {
+				botName = game.Player1Name
+			}
+			botMsg := models.ChatMessage{From: "bot", Name: botName, Text: reply, SentAt: time.Now()}
+			if gh.gameService.AddChat(game.ID, botMsg) == nil {
+				gh.sendChat(game, botMsg)
+			}
+		}()
+	}
+}
+
+// spectatorChat sends a spectator's chat line to the other spectators
+// only, so that they can't coach the players.
+func (gh *GameHandler) spectatorChat(cs *connState, text string) {
+	game, err := gh.gameService.GetGame(cs.watching)
+	if err != nil {
+		gh.sendError(cs.client, err)
+		return
+	}
+	text, err = gh.chat.Prepare(chatSender(cs), text)
+	if err != nil {
+		gh.sendError(cs.client, err)
+		return
+	}
+	name := cs.name
+	if name == "" {
+		name = "Spectator"
+	}
+	msg := models.ChatMessage{Name: name, Text: text, Spectator: true, SentAt: time.Now()}
+	if err := gh.gameService.AddChat(game.ID, msg); err != nil {
+		gh.sendError(cs.client, err)
+		return
+	}
+	gh.sendChat(game, msg)
+}
+
+// sendChat delivers a chat message to everyone who may read it: the
+// spectators always, the players unless it is spectator chat.
+func (gh *GameHandler) sendChat(game *models.Game, msg models.ChatMessage) {
+	response := models.Message{Type: "chat", GameID: game.ID, Payload: msg}
+
+	var recipients []*Client
+	if !msg.Spectator {
+		for _, id := range []string{game.Player1ID, game.Player2ID} {
+			if client := gh.client(id); client != nil && id != "bot" {
+				recipients = append(recipients, client)
+			}
+		}
+	}
+
+	gh.mu.RLock()
+	for client := range gh.spectators[game.ID] {
+		recipients = append(recipients, client)
+	}
+	gh.mu.RUnlock()
+
+	for _, client := range recipients {
+		client.Send(response)
+	}
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"4-in-a-row/models"
+	"4-in-a-row/services"
+	"errors"
+	"net/http"
+)
+
+var (
+	ErrGameNotStarted    = errors.New("game not started")
+	ErrAlreadyPlaying    = errors.New("already playing a game")
+	ErrSpectatorReadOnly = errors.New("spectators cannot play")
+	ErrUnauthorized      = errors.New("missing bearer token")
+	ErrPlayerNotFound    = errors.New("player not found")
+	ErrInvalidStatus     = errors.New("invalid status filter")
+	ErrStreamNotFound    = errors.New("event stream not found")
+	ErrStreamBusy        = errors.New("too many messages queued for this event stream")
+	ErrOpponentLeft      = errors.New("opponent is no longer connected")
+	ErrNoOpenRoom        = errors.New("no open room to cancel")
+)
+
+// errorCodes maps the errors a client can cause to their protocol codes.
+var errorCodes = []struct {
+	err  error
+	code string
+}{
+	{models.ErrMalformedMessage, models.ErrCodeMalformedMessage},
+	{models.ErrUnknownMessageType, models.ErrCodeUnknownMessageType},
+	{models.ErrInvalidPayload, models.ErrCodeInvalidPayload},
+	{ErrGameNotStarted, models.ErrCodeGameNotStarted},
+	{ErrAlreadyPlaying, models.ErrCodeAlreadyPlaying},
+	{ErrSpectatorReadOnly, models.ErrCodeSpectatorReadOnly},
+	{ErrUnauthorized, models.ErrCodeUnauthorized},
+	{ErrPlayerNotFound, models.ErrCodePlayerNotFound},
+	{ErrInvalidStatus, models.ErrCodeInvalidQuery},
+	{ErrStreamNotFound, models.ErrCodeStreamNotFound},
+	{ErrStreamBusy, models.ErrCodeStreamBusy},
+	{ErrOpponentLeft, models.ErrCodeOpponentLeft},
+	{ErrNoOpenRoom, models.ErrCodeNoOpenRoom},
+
+	{services.ErrGameNotFound, models.ErrCodeGameNotFound},
+	{services.ErrGameNotActive, models.ErrCodeGameNotActive},
+	{services.ErrNotPlayersTurn, models.ErrCodeNotYourTurn},
+	{services.ErrInvalidColumn, models.ErrCodeInvalidColumn},
+	{services.ErrColumnFull, models.ErrCodeColumnFull},
+	{services.ErrPopNotAllowed, models.ErrCodePopNotAllowed},
+	{services.ErrCannotPop, models.ErrCodeCannotPop},
+	{services.ErrInvalidMoveKind, models.ErrCodeInvalidMoveKind},
+	{services.ErrTimeExpired, models.ErrCodeTimeExpired},
+	{services.ErrNotInGame, models.ErrCodeNotInGame},
+	{services.ErrTakebackPending, models.ErrCodeTakebackPending},
+	{services.ErrNoTakebackRequest, models.ErrCodeNoTakebackRequest},
+	{services.ErrNothingToTakeBack, models.ErrCodeNothingToTakeBack},
+	{services.ErrNotTakebackResponder, models.ErrCodeNotTakebackResponder},
+	{services.ErrDrawOfferPending, models.ErrCodeDrawOfferPending},
+	{services.ErrNoDrawOffer, models.ErrCodeNoDrawOffer},
+	{services.ErrNotDrawResponder, models.ErrCodeNotDrawResponder},
+	{services.ErrNoHintsLeft, models.ErrCodeNoHintsLeft},
+	{services.ErrHintsUnavailable, models.ErrCodeHintsUnavailable},
+	{services.ErrHintFailed, models.ErrCodeHintFailed},
+	{services.ErrInvalidResumeToken, models.ErrCodeInvalidResumeToken},
+	{models.ErrInvalidBoardSize, models.ErrCodeInvalidBoardSize},
+	{models.ErrInvalidVariant, models.ErrCodeInvalidVariant},
+	{models.ErrInvalidDifficulty, models.ErrCodeInvalidDifficulty},
+	{models.ErrInvalidTimeControl, models.ErrCodeInvalidTimeControl},
+	{services.ErrChatTooLong, models.ErrCodeChatTooLong},
+	{services.ErrChatRateLimited, models.ErrCodeChatRateLimited},
+	{models.ErrInvalidFirstMove, models.ErrCodeInvalidFirstMove},
+	{services.ErrRoomNotFound, models.ErrCodeRoomNotFound},
+	{services.ErrRoomExpired, models.ErrCodeRoomExpired},
+	{services.ErrGameInProgress, models.ErrCodeGameInProgress},
+	{services.ErrRematchPending, models.ErrCodeRematchPending},
+	{services.ErrNoRematchOffer, models.ErrCodeNoRematchOffer},
+	{services.ErrNotRematchResponder, models.ErrCodeNotRematchResponder},
+	{services.ErrRematchStarted, models.ErrCodeRematchStarted},
+}
+
+// errorCode returns the protocol code for err, or INTERNAL for errors the
+// client could not have caused.
+func errorCode(err error) string {
+	for _, e := range errorCodes {
+		if errors.Is(err, e.err) {
+			return e.code
+		}
+	}
+	return models.ErrCodeInternal
+}
+
+// httpStatuses maps error codes to REST API status codes. Codes not
+// listed are conflicts with the game's state.
+var httpStatuses = map[string]int{
+	models.ErrCodeMalformedMessage:   http.StatusBadRequest,
+	models.ErrCodeUnknownMessageType: http.StatusBadRequest,
+	models.ErrCodeInvalidPayload:     http.StatusBadRequest,
+	models.ErrCodeInvalidQuery:       http.StatusBadRequest,
+	models.ErrCodeInvalidColumn:      http.StatusBadRequest,
+	models.ErrCodeInvalidMoveKind:    http.StatusBadRequest,
+	models.ErrCodeInvalidBoardSize:   http.StatusBadRequest,
+	models.ErrCodeInvalidVariant:     http.StatusBadRequest,
+	models.ErrCodeInvalidDifficulty:  http.StatusBadRequest,
+	models.ErrCodeInvalidTimeControl: http.StatusBadRequest,
+	models.ErrCodeChatTooLong:        http.StatusBadRequest,
+	models.ErrCodeInvalidFirstMove:   http.StatusBadRequest,
+	models.ErrCodeChatRateLimited:    http.StatusTooManyRequests,
+	models.ErrCodeUnauthorized:       http.StatusUnauthorized,
+	models.ErrCodeInvalidResumeToken: http.StatusUnauthorized,
+	models.ErrCodeNotInGame:          http.StatusForbidden,
+	models.ErrCodeSpectatorReadOnly:  http.StatusForbidden,
+	models.ErrCodeGameNotFound:       http.StatusNotFound,
+	models.ErrCodePlayerNotFound:     http.StatusNotFound,
+	models.ErrCodeStreamNotFound:     http.StatusNotFound,
+	models.ErrCodeRoomNotFound:       http.StatusNotFound,
+	models.ErrCodeStreamBusy:         http.StatusTooManyRequests,
+	models.ErrCodeHintsUnavailable:   http.StatusNotImplemented,
+	models.ErrCodeHintFailed:         http.StatusServiceUnavailable,
+	models.ErrCodeInternal:           http.StatusInternalServerError,
+}
+
+// httpStatus returns the REST API status code for err.
+func httpStatus(err error) int {
+	if status, ok := httpStatuses[errorCode(err)]; ok {
+		return status
+	}
+	return http.StatusConflict
+}
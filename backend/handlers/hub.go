@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// Time allowed to write a message to the peer
+	writeWait = 10 * time.Second
+	// Time allowed to read the next pong from the peer
+	pongWait = 60 * time.Second
+	// Pings are sent at this period; it must be less than pongWait
+	pingPeriod = 30 * time.Second
+	// Largest message accepted from a client
+	maxMessageSize = 8192
+	// Outbound messages queued per client. A client that falls this far
+	// behind is disconnected rather than holding up the game.
+	sendQueueSize = 64
+)
+
+// Client is a connection owned by the hub. Only its writer writes to the
+// connection; everyone else queues messages with Send. For WebSockets the
+// writer is the hub's write pump; for event streams it is the handler
+// serving the stream, which reads the queue with Outbox. Reading stays
+// with the handler that registered it.
+type Client struct {
+	hub       *Hub
+	conn      *websocket.Conn // nil for event streams
+	addr      string
+	send      chan []byte
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Hub owns every open client connection, WebSocket or event stream.
+type Hub struct {
+	clients map[*Client]bool
+	mu      sync.Mutex
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		clients: make(map[*Client]bool),
+	}
+}
+
+// Register takes ownership of conn and starts its write pump. The caller
+// reads from conn until it fails and then calls Close.
+func (h *Hub) Register(conn *websocket.Conn) *Client {
+	c := h.add(conn, conn.RemoteAddr().String())
+	conn.SetReadLimit(maxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	go c.writePump()
+	return c
+}
+
+// RegisterStream adds a client whose writer is the caller: it must write
+// what arrives on Outbox until Done is closed, then call Close.
+func (h *Hub) RegisterStream(addr string) *Client {
+	return h.add(nil, addr)
+}
+
+func (h *Hub) add(conn *websocket.Conn, addr string) *Client {
+	c := &Client{
+		hub:  h,
+		conn: conn,
+		addr: addr,
+		send: make(chan []byte, sendQueueSize),
+		done: make(chan struct{}),
+	}
+	h.mu.Lock()
+	h.clients[c] = true
+	h.mu.Unlock()
+	return c
+}
+
+// Len returns the number of open connections.
+func (h *Hub) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.clients)
+}
+
+// Send queues v to be written as JSON. It never blocks: if the client's
+// queue is full the client is dropped as a slow consumer. It reports
+// whether the message was queued.
+func (c *Client) Send(v interface{}) bool {
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("Error encoding message: %v\n", err)
+		return false
+	}
+	select {
+	case <-c.done:
+		return false
+	default:
+	}
+	select {
+	case c.send <- data:
+		return true
+	default:
+		log.Printf("Dropping slow client %s\n", c.addr)
+		c.Close()
+		return false
+	}
+}
+
+// Outbox returns the queue of encoded messages for a stream's writer.
+func (c *Client) Outbox() <-chan []byte { return c.send }
+
+// Done is closed when the client is closed.
+func (c *Client) Done() <-chan struct{} { return c.done }
+
+// Close stops the writer and, for WebSockets, closes the connection, which
+// also ends the reader's loop. It is safe to call more than once.
+func (c *Client) Close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.hub.mu.Lock()
+		delete(c.hub.clients, c)
+		c.hub.mu.Unlock()
+	})
+}
+
+// writePump writes queued messages and pings to the connection until the
+// client is closed or a write fails.
+func (c *Client) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+		c.Close()
+	}()
+
+	for {
+		select {
+		case data := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				log.Printf("WebSocket write error: %v\n", err)
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				log.Printf("Ping error: %v\n", err)
+				return
+			}
+		case <-c.done:
+			// Flush what is already queued, e.g. a final error
+			for {
+				select {
+				case data := <-c.send:
+					c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+					if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+						return
+					}
+				default:
+					c.conn.WriteControl(websocket.CloseMessage,
+						websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+						time.Now().Add(writeWait))
+					return
+				}
+			}
+		}
+	}
+}
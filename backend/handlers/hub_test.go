@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// TestSendDropsSlowClient fills a stream client's queue without anyone
+// writing it out: the next message drops the client instead of blocking.
+func TestSendDropsSlowClient(t *testing.T) {
+	hub := NewHub()
+	c := hub.RegisterStream("test")
+	for i := 0; i < sendQueueSize; i++ {
+		if !c.Send(i) {
+			t.Fatalf("message %d not queued", i)
+		}
+	}
+	if c.Send("one too many") {
+		t.Error("message queued past the queue size")
+	}
+	select {
+	case <-c.Done():
+	default:
+		t.Error("slow client not closed")
+	}
+	if hub.Len() != 0 {
+		t.Errorf("hub holds %d clients, want 0", hub.Len())
+	}
+	if c.Send("after close") {
+		t.Error("message queued after close")
+	}
+	c.Close() // closing again is harmless
+}
+
+func TestSendUnencodable(t *testing.T) {
+	hub := NewHub()
+	c := hub.RegisterStream("test")
+	if c.Send(func() {}) {
+		t.Error("unencodable message queued")
+	}
+	if !c.Send("fine") {
+		t.Error("client closed by an unencodable message")
+	}
+}
+
+// wsServer serves WebSockets with a hub client per connection, handing
+// each client to serve.
+func wsServer(t *testing.T, hub *Hub, serve func(c *Client)) *websocket.Conn {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		serve(hub.Register(conn))
+	}))
+	t.Cleanup(srv.Close)
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// TestWritePumpFlushesOnClose checks that messages queued before Close,
+// such as a final error, still reach the client, followed by a normal
+// close.
+func TestWritePumpFlushesOnClose(t *testing.T) {
+	hub := NewHub()
+	conn := wsServer(t, hub, func(c *Client) {
+		for _, s := range []string{"one", "two", "three"} {
+			c.Send(s)
+		}
+		c.Close()
+	})
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for _, want := range []string{"one", "two", "three"} {
+		var got string
+		if err := conn.ReadJSON(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+	_, _, err := conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Errorf("got %v, want a normal close", err)
+	}
+}
+
+// TestSlowWebSocketDropped sends to a WebSocket client that never reads:
+// once the connection and the queue are full, Send drops the client
+// instead of blocking the sender.
+func TestSlowWebSocketDropped(t *testing.T) {
+	hub := NewHub()
+	dropped := make(chan bool, 1)
+	wsServer(t, hub, func(c *Client) {
+		big := strings.Repeat("x", 64<<10)
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			if !c.Send(big) {
+				break
+			}
+		}
+		select {
+		case <-c.Done():
+			dropped <- true
+		default:
+			dropped <- false
+		}
+	})
+
+	select {
+	case ok := <-dropped:
+		if !ok {
+			t.Error("client that never reads was not dropped")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Send blocked")
+	}
+	if hub.Len() != 0 {
+		t.Errorf("hub holds %d clients, want 0", hub.Len())
+	}
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"4-in-a-row/models"
+	"log"
+)
+
+// offerRematch offers the opponent a rematch of the client's finished
+// game. The bot accepts every rematch.
+func (gh *GameHandler) offerRematch(cs *connState) {
+	game, err := gh.gameService.OfferRematch(cs.game(), cs.playerID)
+	if err != nil {
+		gh.sendError(cs.client, err)
+		return
+	}
+	if game.IsBot {
+		game, rematch, err := gh.gameService.RespondRematch(game.ID, "bot", true)
+		if err != nil {
+			gh.sendError(cs.client, err)
+			return
+		}
+		gh.startRematch(game, rematch)
+		return
+	}
+	gh.broadcastGameState(game, "Rematch offered")
+}
+
+// respondRematch answers the opponent's rematch offer.
+func (gh *GameHandler) respondRematch(cs *connState, accept bool) {
+	if accept {
+		// The new game would wait forever for an opponent who left
+		game, err := gh.gameService.GetGame(cs.game())
+		if err != nil {
+			gh.sendError(cs.client, err)
+			return
+		}
+		offerer := gh.client(game.RematchOfferedBy)
+		if game.RematchOfferedBy != "" && offerer == nil {
+			gh.sendError(cs.client, ErrOpponentLeft)
+			return
+		}
+	}
+
+	game, rematch, err := gh.gameService.RespondRematch(cs.game(), cs.playerID, accept)
+	if err != nil {
+		gh.sendError(cs.client, err)
+		return
+	}
+	if rematch == nil {
+		gh.broadcastGameState(game, "Rematch declined")
+		return
+	}
+	gh.startRematch(game, rematch)
+}
+
+// startRematch moves both players' connections on to the rematch of
+// game, each with a new resume token. A player who left since the offer
+// forfeits the rematch.
+func (gh *GameHandler) startRematch(game, rematch *models.Game) {
+	log.Printf("Rematch of %s started: %s\n", game.ID, rematch.ID)
+	gh.sendToSpectators(game, "Rematch started")
+
+	var absent []string
+	for _, playerID := range []string{rematch.Player1ID, rematch.Player2ID} {
+		if playerID == "bot" {
+			continue
+		}
+		token := gh.sessions.Create(playerID, rematch.ID)
+		if !gh.moveToGame(playerID, rematch.ID) {
+			absent = append(absent, playerID)
+			continue
+		}
+		payload := gh.statePayload(rematch, playerID, "Rematch started! Colors are swapped.")
+		payload.ResumeToken = token
+		if client := gh.client(playerID); client != nil {
+			client.Send(models.Message{
+				Type:    "game-state",
+				GameID:  rematch.ID,
+				Payload: payload,
+			})
+		}
+	}
+	for _, playerID := range absent {
+		gh.forfeitAbsent(rematch.ID, playerID)
+	}
+
+	if len(absent) == 0 && rematch.IsBot && rematch.CurrentTurn == "bot" {
+		go gh.playBotMove(rematch)
+	}
+}
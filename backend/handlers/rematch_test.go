@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"4-in-a-row/models"
+
+	"github.com/gorilla/websocket"
+)
+
+// finishedRoomGame starts a room game between two new players, which the
+// host resigns. It returns the host's and guest's player IDs and the game.
+func finishedRoomGame(t *testing.T, host, guest *websocket.Conn) (hostID, guestID, gameID string) {
+	t.Helper()
+	code := createRoom(t, host, models.RoomOptions{})
+	sendMessage(t, guest, "join-room", models.JoinRoomPayload{Username: "guest", Code: code})
+	guestState := awaitState(t, guest, started)
+	hostState := awaitState(t, host, started)
+
+	sendMessage(t, host, "resign", nil)
+	resigned := func(state *models.GameStatePayload) bool { return state.Game.Status == "resigned" }
+	awaitState(t, host, resigned)
+	awaitState(t, guest, resigned)
+	return hostState.PlayerID, guestState.PlayerID, hostState.Game.ID
+}
+
+func TestRematchHandshake(t *testing.T) {
+	gh, _, _ := newTestHandler()
+	srv := httptest.NewServer(http.HandlerFunc(gh.HandleWebSocket))
+	defer srv.Close()
+	host, guest := connect(t, srv), connect(t, srv)
+	hostID, guestID, gameID := finishedRoomGame(t, host, guest)
+
+	offered := func(state *models.GameStatePayload) bool { return state.Game.RematchOfferedBy == guestID }
+	sendMessage(t, guest, "rematch-offer", nil)
+	awaitState(t, host, offered)
+	awaitState(t, guest, offered)
+
+	// Only the opponent answers, and only once
+	sendMessage(t, guest, "rematch-accept", nil)
+	awaitError(t, guest, models.ErrCodeNotRematchResponder)
+	sendMessage(t, guest, "rematch-offer", nil)
+	awaitError(t, guest, models.ErrCodeRematchPending)
+
+	sendMessage(t, host, "rematch-decline", nil)
+	declined := func(state *models.GameStatePayload) bool {
+		return state.Game.ID == gameID && state.Game.RematchOfferedBy == ""
+	}
+	awaitState(t, guest, declined)
+	awaitState(t, host, declined)
+	sendMessage(t, host, "rematch-accept", nil)
+	awaitError(t, host, models.ErrCodeNoRematchOffer)
+
+	sendMessage(t, guest, "rematch-offer", nil)
+	awaitState(t, host, offered)
+	sendMessage(t, host, "rematch-accept", nil)
+	hostState := awaitState(t, host, started)
+	guestState := awaitState(t, guest, started)
+
+	rematch := hostState.Game
+	if rematch.ID == gameID || guestState.Game.ID != rematch.ID {
+		t.Fatalf("host in %s, guest in %s after a rematch of %s", rematch.ID, guestState.Game.ID, gameID)
+	}
+	if rematch.Player1ID != guestID || rematch.Player2ID != hostID || rematch.CurrentTurn != guestID {
+		t.Errorf("rematch players %s, %s, %s to move; want colors swapped", rematch.Player1ID, rematch.Player2ID, rematch.CurrentTurn)
+	}
+	if !rematch.Private {
+		t.Error("rematch of a private game is public")
+	}
+	series := hostState.Series
+	if series == nil || series.Games != 1 || series.Wins[guestID] != 1 {
+		t.Errorf("series %+v, want the guest's win", series)
+	}
+	if hostState.ResumeToken == guestState.ResumeToken {
+		t.Error("players share a resume token")
+	}
+
+	// Offers now go to the rematch, which is being played
+	sendMessage(t, host, "rematch-offer", nil)
+	awaitError(t, host, models.ErrCodeGameInProgress)
+
+	sendMessage(t, guest, "move", models.MovePayload{Column: 0})
+	awaitState(t, host, func(state *models.GameStatePayload) bool {
+		return state.Game.ID == rematch.ID && len(state.Game.Moves) == 1
+	})
+}
+
+// TestRematchOffererLeft checks that a rematch cannot be accepted once the
+// player who offered it has left.
+func TestRematchOffererLeft(t *testing.T) {
+	gh, _, _ := newTestHandler()
+	srv := httptest.NewServer(http.HandlerFunc(gh.HandleWebSocket))
+	defer srv.Close()
+	host, guest := connect(t, srv), connect(t, srv)
+	_, guestID, _ := finishedRoomGame(t, host, guest)
+
+	sendMessage(t, guest, "rematch-offer", nil)
+	awaitState(t, host, func(state *models.GameStatePayload) bool { return state.Game.RematchOfferedBy == guestID })
+	guest.Close()
+	for deadline := time.Now().Add(5 * time.Second); gh.client(guestID) != nil; {
+		if time.Now().After(deadline) {
+			t.Fatal("guest still connected")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	sendMessage(t, host, "rematch-accept", nil)
+	awaitError(t, host, models.ErrCodeOpponentLeft)
+}
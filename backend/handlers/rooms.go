@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"4-in-a-row/models"
+	"4-in-a-row/services"
+	"log"
+	"time"
+)
+
+// createRoom opens a private room and sends the host its code. The host's
+// connection keeps reading while the room waits for the opponent; see
+// awaitRoom.
+func (gh *GameHandler) createRoom(cs *connState, create *models.CreateRoomPayload) {
+	opts, err := create.RoomOptions.Normalize()
+	if err != nil {
+		gh.sendError(cs.client, err)
+		return
+	}
+	gh.closeRoom(cs)
+	gh.newPlayer(cs, newPlayerID(create.Username), create.Username)
+
+	room := gh.rooms.Create(cs.playerID, create.Username, opts)
+	cs.room = room
+	log.Printf("Room %s created by %s\n", room.Code, cs.playerID)
+	cs.client.Send(models.Message{
+		Type:    "room-created",
+		Payload: roomPayload(room),
+	})
+	go gh.awaitRoom(room)
+}
+
+// awaitRoom waits until someone joins the room, the host closes it or it
+// expires. Rooms that nobody joins never fall back to the bot.
+func (gh *GameHandler) awaitRoom(room *services.Room) {
+	expired := time.NewTimer(time.Until(room.ExpiresAt))
+	defer expired.Stop()
+	select {
+	case game := <-room.Channel:
+		gh.startHostGame(room, game)
+
+	case <-room.Closed():
+
+	case <-expired.C:
+		if !gh.rooms.Close(room) {
+			// Joined or cancelled just as it expired
+			select {
+			case game := <-room.Channel:
+				gh.startHostGame(room, game)
+			case <-room.Closed():
+			}
+			return
+		}
+		log.Printf("Room %s expired\n", room.Code)
+		if client := gh.client(room.HostID); client != nil {
+			gh.sendError(client, services.ErrRoomExpired)
+		}
+	}
+}
+
+// startHostGame moves the host of a room that was joined into its game. A
+// host who left in the meantime forfeits: there is no one to come back.
+func (gh *GameHandler) startHostGame(room *services.Room, matched *models.Game) {
+	game, err := gh.gameService.StoreGame(matched)
+	if err != nil {
+		log.Printf("Room %s: %v\n", room.Code, err)
+		return
+	}
+	token := gh.sessions.Create(room.HostID, game.ID)
+	if !gh.moveToGame(room.HostID, game.ID) {
+		gh.forfeitAbsent(game.ID, room.HostID)
+		return
+	}
+
+	payload := gh.statePayload(game, room.HostID, "Game started! Your turn.")
+	payload.ResumeToken = token
+	if client := gh.client(room.HostID); client != nil {
+		client.Send(models.Message{
+			Type:    "game-state",
+			GameID:  game.ID,
+			Payload: payload,
+		})
+	}
+}
+
+// cancelRoom closes the room the client hosts, if nobody joined it yet.
+func (gh *GameHandler) cancelRoom(cs *connState) {
+	room := cs.room
+	cs.room = nil
+	if room == nil || !gh.rooms.Close(room) {
+		gh.sendError(cs.client, ErrNoOpenRoom)
+		return
+	}
+	log.Printf("Room %s cancelled\n", room.Code)
+	cs.client.Send(models.Message{
+		Type:    "room-cancelled",
+		Payload: roomPayload(room),
+	})
+}
+
+// closeRoom quietly closes the room the client hosts, if any, before the
+// client moves on. If the room was joined already, awaitRoom still starts
+// its game.
+func (gh *GameHandler) closeRoom(cs *connState) {
+	if cs.room != nil {
+		gh.rooms.Close(cs.room)
+		cs.room = nil
+	}
+}
+
+// joinRoom starts the game of the private room with the given code. The
+// client only becomes a new player once the code turns out to be good.
+func (gh *GameHandler) joinRoom(cs *connState, join *models.JoinRoomPayload) {
+	playerID := newPlayerID(join.Username)
+	game, err := gh.rooms.Join(join.Code, playerID, join.Username)
+	if err != nil {
+		gh.sendError(cs.client, err)
+		return
+	}
+	gh.closeRoom(cs)
+	gh.newPlayer(cs, playerID, join.Username)
+	gh.startGame(cs, game)
+}
+
+func roomPayload(room *services.Room) models.RoomPayload {
+	return models.RoomPayload{
+		Code:      room.Code,
+		Options:   room.Options,
+		ExpiresAt: room.ExpiresAt,
+	}
+}
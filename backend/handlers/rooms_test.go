@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"4-in-a-row/models"
+	"4-in-a-row/services"
+
+	"github.com/gorilla/websocket"
+)
+
+// connect opens a WebSocket to srv and reads its hello.
+func connect(t *testing.T, srv *httptest.Server) *websocket.Conn {
+	t.Helper()
+	conn, _, err := dialGame(t, srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msgType, _ := readMessage(t, conn); msgType != "hello" {
+		t.Fatalf("first message %s, want hello", msgType)
+	}
+	return conn
+}
+
+func sendMessage(t *testing.T, conn *websocket.Conn, msgType string, payload interface{}) {
+	t.Helper()
+	if err := conn.WriteJSON(models.Message{Type: msgType, Payload: payload}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// awaitMessage reads messages up to the next one of type msgType and
+// returns its payload, skipping the others.
+func awaitMessage(t *testing.T, conn *websocket.Conn, msgType string) json.RawMessage {
+	t.Helper()
+	for {
+		if got, payload := readMessage(t, conn); got == msgType {
+			return payload
+		}
+	}
+}
+
+// awaitState reads messages up to the next game state that match
+// accepts, skipping the rest.
+func awaitState(t *testing.T, conn *websocket.Conn, match func(*models.GameStatePayload) bool) *models.GameStatePayload {
+	t.Helper()
+	for {
+		var state models.GameStatePayload
+		if err := json.Unmarshal(awaitMessage(t, conn, "game-state"), &state); err != nil {
+			t.Fatal(err)
+		}
+		if match(&state) {
+			return &state
+		}
+	}
+}
+
+// awaitError reads messages up to the next error and checks its code.
+func awaitError(t *testing.T, conn *websocket.Conn, code string) {
+	t.Helper()
+	var e models.ErrorPayload
+	if err := json.Unmarshal(awaitMessage(t, conn, "error"), &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Code != code {
+		t.Errorf("error %s (%s), want %s", e.Code, e.Error, code)
+	}
+}
+
+// createRoom has the host open a room and returns its code.
+func createRoom(t *testing.T, host *websocket.Conn, opts models.RoomOptions) string {
+	t.Helper()
+	sendMessage(t, host, "create-room", models.CreateRoomPayload{Username: "host", RoomOptions: opts})
+	var room models.RoomPayload
+	if err := json.Unmarshal(awaitMessage(t, host, "room-created"), &room); err != nil {
+		t.Fatal(err)
+	}
+	if room.Code == "" {
+		t.Fatal("room created without a code")
+	}
+	return room.Code
+}
+
+// started matches the first state of a game, which carries the player's
+// resume token.
+func started(state *models.GameStatePayload) bool {
+	return state.ResumeToken != ""
+}
+
+func TestRoomJoin(t *testing.T) {
+	gh, _, _ := newTestHandler()
+	srv := httptest.NewServer(http.HandlerFunc(gh.HandleWebSocket))
+	defer srv.Close()
+	host, guest := connect(t, srv), connect(t, srv)
+
+	code := createRoom(t, host, models.RoomOptions{FirstMove: models.FirstMoveGuest, Unrated: true})
+
+	// Codes are typed in by hand
+	typed := strings.ToLower(code[:3]) + "-" + code[3:]
+	sendMessage(t, guest, "join-room", models.JoinRoomPayload{Username: "guest", Code: typed})
+	guestState := awaitState(t, guest, started)
+	hostState := awaitState(t, host, started)
+
+	game := hostState.Game
+	if game.ID != guestState.Game.ID {
+		t.Fatalf("host in %s, guest in %s", game.ID, guestState.Game.ID)
+	}
+	if !game.Private || !game.Unrated || game.IsBot {
+		t.Errorf("game private %v, unrated %v, bot %v", game.Private, game.Unrated, game.IsBot)
+	}
+	if game.Player1ID != guestState.PlayerID || game.Player2ID != hostState.PlayerID {
+		t.Errorf("players %s, %s; want the guest %s first", game.Player1ID, game.Player2ID, guestState.PlayerID)
+	}
+
+	// The room is gone once joined
+	third := connect(t, srv)
+	sendMessage(t, third, "join-room", models.JoinRoomPayload{Username: "third", Code: code})
+	awaitError(t, third, models.ErrCodeRoomNotFound)
+	sendMessage(t, host, "cancel-room", nil)
+	awaitError(t, host, models.ErrCodeNoOpenRoom)
+
+	// The guest moves first, and the host sees it
+	sendMessage(t, guest, "move", models.MovePayload{Column: 3})
+	awaitState(t, host, func(state *models.GameStatePayload) bool {
+		return len(state.Game.Moves) == 1 && state.Game.CurrentTurn == hostState.PlayerID
+	})
+}
+
+func TestRoomExpiry(t *testing.T) {
+	gh, _, _ := newTestHandler()
+	gh.rooms = services.NewRoomService(50 * time.Millisecond)
+	srv := httptest.NewServer(http.HandlerFunc(gh.HandleWebSocket))
+	defer srv.Close()
+	host := connect(t, srv)
+
+	code := createRoom(t, host, models.RoomOptions{})
+	awaitError(t, host, models.ErrCodeRoomExpired)
+
+	guest := connect(t, srv)
+	sendMessage(t, guest, "join-room", models.JoinRoomPayload{Username: "guest", Code: code})
+	awaitError(t, guest, models.ErrCodeRoomNotFound)
+}
+
+func TestRoomCancel(t *testing.T) {
+	gh, _, _ := newTestHandler()
+	srv := httptest.NewServer(http.HandlerFunc(gh.HandleWebSocket))
+	defer srv.Close()
+	host := connect(t, srv)
+
+	code := createRoom(t, host, models.RoomOptions{})
+	sendMessage(t, host, "cancel-room", nil)
+	var room models.RoomPayload
+	if err := json.Unmarshal(awaitMessage(t, host, "room-cancelled"), &room); err != nil || room.Code != code {
+		t.Errorf("room-cancelled for %q (%v), want %q", room.Code, err, code)
+	}
+	sendMessage(t, host, "cancel-room", nil)
+	awaitError(t, host, models.ErrCodeNoOpenRoom)
+
+	guest := connect(t, srv)
+	sendMessage(t, guest, "join-room", models.JoinRoomPayload{Username: "guest", Code: code})
+	awaitError(t, guest, models.ErrCodeRoomNotFound)
+}
+
+// TestRoomCancelledAsItExpires has the room's expiry and its cancelling
+// ready at once: awaitRoom must return whichever it picks.
+func TestRoomCancelledAsItExpires(t *testing.T) {
+	gh, _, _ := newTestHandler()
+	gh.rooms = services.NewRoomService(0)
+	opts, _ := models.RoomOptions{}.Normalize()
+	for i := 0; i < 50; i++ {
+		room := gh.rooms.Create("host", "host", opts)
+		gh.rooms.Close(room)
+		done := make(chan struct{})
+		go func() {
+			gh.awaitRoom(room)
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("awaitRoom still waiting for a cancelled room")
+		}
+	}
+}
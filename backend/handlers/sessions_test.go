@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"4-in-a-row/models"
+)
+
+// TestReconnect drops the guest of a room game twice: the first time they
+// rejoin within the grace period and play on, the second time they stay
+// away and forfeit.
+func TestReconnect(t *testing.T) {
+	const grace = 300 * time.Millisecond
+	gh, _, _ := newTestHandlerGrace(grace)
+	srv := httptest.NewServer(http.HandlerFunc(gh.HandleWebSocket))
+	defer srv.Close()
+	host, guest := connect(t, srv), connect(t, srv)
+
+	code := createRoom(t, host, models.RoomOptions{})
+	sendMessage(t, guest, "join-room", models.JoinRoomPayload{Username: "guest", Code: code})
+	guestState := awaitState(t, guest, started)
+	hostState := awaitState(t, host, started)
+	token := guestState.ResumeToken
+
+	guest.Close()
+	awaitState(t, host, func(state *models.GameStatePayload) bool {
+		return strings.HasPrefix(state.Message, "Opponent disconnected")
+	})
+	guest = connect(t, srv)
+	sendMessage(t, guest, "rejoin", models.RejoinPayload{Token: token})
+	resumed := awaitState(t, guest, func(state *models.GameStatePayload) bool { return state.Message == "Reconnected" })
+	if resumed.PlayerID != guestState.PlayerID || resumed.Game.ID != hostState.Game.ID || resumed.ResumeToken != token {
+		t.Fatalf("rejoined as %s in %s", resumed.PlayerID, resumed.Game.ID)
+	}
+
+	// Still in the game after the grace period, and able to move
+	time.Sleep(2 * grace)
+	mover := guest
+	if hostState.Game.CurrentTurn == hostState.PlayerID {
+		mover = host
+	}
+	sendMessage(t, mover, "move", models.MovePayload{Column: 3})
+	awaitState(t, host, func(state *models.GameStatePayload) bool {
+		return len(state.Game.Moves) == 1 && state.Game.Status == "active"
+	})
+
+	guest.Close()
+	ended := awaitState(t, host, func(state *models.GameStatePayload) bool { return state.Game.Status != "active" })
+	if ended.Game.Status != "abandoned" || ended.Game.Winner != hostState.PlayerID {
+		t.Errorf("game %s, won by %q; want abandoned to the host", ended.Game.Status, ended.Game.Winner)
+	}
+
+	guest = connect(t, srv)
+	sendMessage(t, guest, "rejoin", models.RejoinPayload{Token: token})
+	awaitError(t, guest, models.ErrCodeInvalidResumeToken)
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"4-in-a-row/models"
+	"4-in-a-row/services"
+	"log"
+)
+
+// watch adds client to the spectators of gameID and sends it the game. The
+// players are told someone is watching.
+func (gh *GameHandler) watch(client *Client, gameID string) error {
+	game, err := gh.gameService.GetGame(gameID)
+	if err != nil {
+		return err
+	}
+	if game.Status != "active" {
+		return services.ErrGameNotActive
+	}
+
+	gh.mu.Lock()
+	if gh.spectators[gameID] == nil {
+		gh.spectators[gameID] = make(map[*Client]bool)
+	}
+	gh.spectators[gameID][client] = true
+	gh.mu.Unlock()
+	log.Printf("Spectator watching game %s\n", gameID)
+
+	client.Send(models.Message{
+		Type:    "game-state",
+		GameID:  game.ID,
+		Payload: gh.statePayload(game, "", "Watching "+game.Player1Name+" vs "+game.Player2Name),
+	})
+	gh.sendToPlayers(game, "A spectator joined")
+	return nil
+}
+
+// unwatch removes client from the spectators of gameID and tells the players
+// if the game is still going.
+func (gh *GameHandler) unwatch(client *Client, gameID string) {
+	gh.mu.Lock()
+	delete(gh.spectators[gameID], client)
+	if len(gh.spectators[gameID]) == 0 {
+		delete(gh.spectators, gameID)
+	}
+	gh.mu.Unlock()
+
+	if game, err := gh.gameService.GetGame(gameID); err == nil && game.Status == "active" {
+		gh.sendToPlayers(game, "A spectator left")
+	}
+}
+
+// spectatorCount returns how many connections are watching gameID.
+func (gh *GameHandler) spectatorCount(gameID string) int {
+	gh.mu.RLock()
+	defer gh.mu.RUnlock()
+	return len(gh.spectators[gameID])
+}
+
+// sendToSpectators sends the game state to everyone watching the game.
+func (gh *GameHandler) sendToSpectators(game *models.Game, message string) {
+	gh.mu.RLock()
+	clients := make([]*Client, 0, len(gh.spectators[game.ID]))
+	for client := range gh.spectators[game.ID] {
+		clients = append(clients, client)
+	}
+	gh.mu.RUnlock()
+	if len(clients) == 0 {
+		return
+	}
+
+	response := models.Message{
+		Type:    "game-state",
+		GameID:  game.ID,
+		Payload: gh.statePayload(game, "", message),
+	}
+	for _, client := range clients {
+		client.Send(response)
+	}
+}
+
+// sendGameList sends the games in progress that can be watched. Games
+// in private rooms are left out; they can still be watched by ID.
+func (gh *GameHandler) sendGameList(client *Client) {
+	games := gh.gameService.Games(func(game *models.Game) bool {
+		return game.Status == "active" && !game.Private
+	})
+	list := models.GameListPayload{Games: make([]models.GameSummary, 0, len(games))}
+	for _, game := range games {
+		list.Games = append(list.Games, models.NewGameSummary(game, gh.spectatorCount(game.ID)))
+	}
+	client.Send(models.Message{Type: "game-list", Payload: list})
+}
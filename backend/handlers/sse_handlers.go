@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"4-in-a-row/models"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Messages posted to a stream and not yet handled
+const streamInboxSize = 16
+
+// Variables so that tests can shorten them
+var (
+	// Comment lines are sent this often so that proxies keep idle
+	// streams open
+	streamPingPeriod = 15 * time.Second
+	// Time allowed to write and flush one event
+	streamWriteWait = writeWait
+)
+
+// stream is a client on the Server-Sent Events transport, for networks
+// that break WebSocket upgrades. The server's messages go out as events on
+// a long-lived GET, and the client POSTs its messages.
+type stream struct {
+	cs    *connState
+	inbox chan []byte
+}
+
+// HandleEvents serves GET /events, the event stream. Every event's data is
+// a message as it would be sent over the WebSocket, starting with a hello
+// that names the stream to POST to. A protocol version may be picked with
+// ?protocol=connect4.v<N>.
+func (gh *GameHandler) HandleEvents(w http.ResponseWriter, r *http.Request) {
+	version := models.MinProtocolVersion
+	if p := r.URL.Query().Get("protocol"); p != "" {
+		v, ok := models.ParseSubprotocol(p)
+		if !ok {
+			http.Error(w, "unsupported protocol version", http.StatusBadRequest)
+			return
+		}
+		version = v
+	}
+	rc := http.NewResponseController(w)
+
+	client := gh.hub.RegisterStream(r.RemoteAddr)
+	defer client.Close()
+	id := generateID()
+	st := &stream{
+		cs:    newConnState(client),
+		inbox: make(chan []byte, streamInboxSize),
+	}
+	gh.mu.Lock()
+	gh.streams[id] = st
+	gh.mu.Unlock()
+	defer gh.closeStream(id)
+
+	// Posted messages are handled in order, like the WebSocket read loop
+	go func() {
+		for data := range st.inbox {
+			gh.handleFrame(st.cs, data)
+		}
+		gh.disconnect(st.cs)
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	client.Send(models.Message{
+		Type: "hello",
+		Payload: models.HelloPayload{
+			Version:    version,
+			MinVersion: models.MinProtocolVersion,
+			MaxVersion: models.ProtocolVersion,
+			Stream:     id,
+		},
+	})
+	log.Printf("Event stream %s opened\n", id)
+
+	ticker := time.NewTicker(streamPingPeriod)
+	defer ticker.Stop()
+	for {
+		// The deadline is set only once there is something to write: the
+		// stream may sit idle for a whole ping period
+		var err error
+		select {
+		case data := <-client.Outbox():
+			rc.SetWriteDeadline(time.Now().Add(streamWriteWait))
+			_, err = fmt.Fprintf(w, "data: %s\n\n", data)
+		case <-ticker.C:
+			rc.SetWriteDeadline(time.Now().Add(streamWriteWait))
+			_, err = io.WriteString(w, ": ping\n\n")
+		case <-client.Done():
+			return
+		case <-r.Context().Done():
+			log.Printf("Event stream %s closed\n", id)
+			return
+		}
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			log.Printf("Event stream %s write error: %v\n", id, err)
+			return
+		}
+	}
+}
+
+// HandleEventPost serves POST /events/{id}: the body is one client
+// message for the stream, which is answered on the stream.
+func (gh *GameHandler) HandleEventPost(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxMessageSize))
+	if err != nil {
+		writeAPIError(w, models.ErrMalformedMessage)
+		return
+	}
+
+	// Holding the lock keeps closeStream from closing the inbox meanwhile
+	gh.mu.RLock()
+	defer gh.mu.RUnlock()
+	st := gh.streams[mux.Vars(r)["id"]]
+	if st == nil {
+		writeAPIError(w, ErrStreamNotFound)
+		return
+	}
+	select {
+	case st.inbox <- data:
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		writeAPIError(w, ErrStreamBusy)
+	}
+}
+
+// closeStream stops taking messages for a stream; the stream's handler
+// goroutine then disconnects it.
+func (gh *GameHandler) closeStream(id string) {
+	gh.mu.Lock()
+	defer gh.mu.Unlock()
+	if st := gh.streams[id]; st != nil {
+		delete(gh.streams, id)
+		close(st.inbox)
+	}
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"4-in-a-row/models"
+
+	"github.com/gorilla/mux"
+)
+
+// eventReader reads a Server-Sent Events stream line by line.
+type eventReader struct {
+	t     *testing.T
+	lines chan string
+}
+
+func newEventReader(t *testing.T, resp *http.Response) *eventReader {
+	er := &eventReader{t: t, lines: make(chan string)}
+	go func() {
+		defer close(er.lines)
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			if line := scanner.Text(); line != "" {
+				er.lines <- line
+			}
+		}
+	}()
+	return er
+}
+
+// next returns the next non-empty line, failing if the stream ends or
+// stays silent for too long.
+func (er *eventReader) next() string {
+	er.t.Helper()
+	select {
+	case line, ok := <-er.lines:
+		if !ok {
+			er.t.Fatal("event stream closed")
+		}
+		return line
+	case <-time.After(5 * time.Second):
+		er.t.Fatal("no event")
+	}
+	return ""
+}
+
+// message reads lines up to the next event and decodes its message,
+// skipping pings.
+func (er *eventReader) message() (msgType string, payload json.RawMessage) {
+	er.t.Helper()
+	for {
+		line := er.next()
+		if data, ok := strings.CutPrefix(line, "data: "); ok {
+			var msg struct {
+				Type    string          `json:"type"`
+				Payload json.RawMessage `json:"payload"`
+			}
+			if err := json.Unmarshal([]byte(data), &msg); err != nil {
+				er.t.Fatalf("event %q: %v", data, err)
+			}
+			return msg.Type, msg.Payload
+		}
+	}
+}
+
+// TestEventStreamIdle keeps a stream open across several ping periods,
+// longer than the write deadline, and checks that it still carries pings
+// and answers to posted messages.
+func TestEventStreamIdle(t *testing.T) {
+	ping, wait := streamPingPeriod, streamWriteWait
+	streamPingPeriod, streamWriteWait = 100*time.Millisecond, 30*time.Millisecond
+	t.Cleanup(func() { streamPingPeriod, streamWriteWait = ping, wait })
+
+	gh, _, _ := newTestHandler()
+	router := mux.NewRouter()
+	router.HandleFunc("/events", gh.HandleEvents).Methods(http.MethodGet)
+	router.HandleFunc("/events/{id}", gh.HandleEventPost).Methods(http.MethodPost)
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	events := newEventReader(t, resp)
+
+	msgType, payload := events.message()
+	var hello models.HelloPayload
+	if err := json.Unmarshal(payload, &hello); msgType != "hello" || err != nil || hello.Stream == "" {
+		t.Fatalf("first event %s %s, want a hello naming the stream", msgType, payload)
+	}
+
+	for pings := 0; pings < 3; {
+		if line := events.next(); line == ": ping" {
+			pings++
+		} else {
+			t.Fatalf("unexpected line %q on an idle stream", line)
+		}
+	}
+
+	post, err := http.Post(srv.URL+"/events/"+hello.Stream, "application/json", strings.NewReader(`{"type":"no-such-type"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	post.Body.Close()
+	if post.StatusCode != http.StatusAccepted {
+		t.Fatalf("POST status %d, want %d", post.StatusCode, http.StatusAccepted)
+	}
+	if msgType, payload := events.message(); msgType != "error" {
+		t.Errorf("answer %s %s, want an error", msgType, payload)
+	}
+}
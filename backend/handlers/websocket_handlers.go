@@ -3,6 +3,7 @@ package handlers
 import (
 	"4-in-a-row/models"
 	"4-in-a-row/services"
+	"fmt"
 	"log"
 	"net/http"
 	"sync"
@@ -18,239 +19,684 @@ var upgrader = websocket.Upgrader{
 	},
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
+	Subprotocols:    models.Subprotocols(),
 }
 
 type GameHandler struct {
 	gameService      *services.GameService
-	botService       *services.BotService
+	bot              services.Bot
 	matchService     *services.MatchmakingService
 	analyticsService *services.AnalyticsService
-	clients          map[string]*websocket.Conn
+	sessions         *services.SessionService
+	chat             *services.ChatService
+	rooms            *services.RoomService
+	hub              *Hub
+	players          map[string]*connState       // player ID -> their connection
+	spectators       map[string]map[*Client]bool // game ID -> watching clients
+	streams          map[string]*stream          // event streams by ID
 	mu               sync.RWMutex
 }
 
-func NewGameHandler(gs *services.GameService, bs *services.BotService, ms *services.MatchmakingService, ans *services.AnalyticsService) *GameHandler {
+func NewGameHandler(gs *services.GameService, bot services.Bot, ms *services.MatchmakingService, ans *services.AnalyticsService, ss *services.SessionService, cs *services.ChatService, rs *services.RoomService) *GameHandler {
 	return &GameHandler{
 		gameService:      gs,
-		botService:       bs,
+		bot:              bot,
 		matchService:     ms,
 		analyticsService: ans,
-		clients:          make(map[string]*websocket.Conn),
+		sessions:         ss,
+		chat:             cs,
+		rooms:            rs,
+		hub:              NewHub(),
+		players:          make(map[string]*connState),
+		spectators:       make(map[string]map[*Client]bool),
+		streams:          make(map[string]*stream),
 	}
 }
 
 func (gh *GameHandler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
+	// Clients that ask for protocol versions must share one with us
+	if requested := websocket.Subprotocols(r); len(requested) > 0 && !supportsAny(requested) {
+		http.Error(w, "unsupported protocol version", http.StatusBadRequest)
+		return
+	}
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Println("WebSocket upgrade error:", err)
 		return
 	}
-	defer conn.Close()
-
-	var playerID string
-	var gameID string
-
-	// Ping ticker to keep connection alive
-	ticker := time.NewTicker(30 * time.Second)
-	defer ticker.Stop()
-
-	// Done channel to signal goroutine to stop
-	done := make(chan bool)
-	defer close(done)
-
-	// Start ping goroutine
-	go func() {
-		for {
-			select {
-			case <-ticker.C:
-				err := conn.WriteMessage(websocket.PingMessage, []byte{})
-				if err != nil {
-					log.Printf("Ping error: %v\n", err)
-					return
-				}
-			case <-done:
-				return
-			}
-		}
-	}()
+	version, ok := models.ParseSubprotocol(conn.Subprotocol())
+	if !ok {
+		version = models.MinProtocolVersion
+	}
+
+	// The hub owns writing to the connection; this loop only reads
+	client := gh.hub.Register(conn)
+	defer client.Close()
+	client.Send(models.Message{
+		Type: "hello",
+		Payload: models.HelloPayload{
+			Version:    version,
+			MinVersion: models.MinProtocolVersion,
+			MaxVersion: models.ProtocolVersion,
+		},
+	})
+
+	cs := newConnState(client)
+	defer gh.disconnect(cs)
 
 	for {
-		var msg models.Message
-		err := conn.ReadJSON(&msg)
+		_, data, err := conn.ReadMessage()
 		if err != nil {
-			log.Printf("WebSocket read error for player %s: %v\n", playerID, err)
-			break
+			log.Printf("WebSocket read error for player %s: %v\n", cs.playerID, err)
+			return
 		}
+		gh.handleFrame(cs, data)
+	}
+}
 
-		switch msg.Type {
-		case "join":
-			payload := msg.Payload.(map[string]interface{})
-			username := payload["username"].(string)
-			playerID = username + "_" + generateID()
+// connState is what the handler knows about one client, whatever its
+// transport. A client's messages are handled one at a time.
+type connState struct {
+	id       string
+	client   *Client
+	name     string // username, for chat
+	playerID string
+	watching string         // game this client spectates, if any
+	room     *services.Room // private room this client hosts, while open
+
+	// gameID is also set from other clients' goroutines, when someone
+	// joins this client's room or starts a rematch.
+	gameID string
+	mu     sync.Mutex
+}
 
-			log.Printf("Player joining: %s (playerID: %s)\n", username, playerID)
+func newConnState(client *Client) *connState {
+	return &connState{id: generateID(), client: client}
+}
 
-			// Register player IMMEDIATELY and ALWAYS
-			gh.mu.Lock()
-			gh.clients[playerID] = conn
-			gh.mu.Unlock()
-			log.Printf("Stored connection for playerID: %s\n", playerID)
+// game returns the ID of the game the client plays in, if any.
+func (cs *connState) game() string {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.gameID
+}
 
-			// Matchmaking
-			game := gh.matchService.AddPlayer(playerID, username)
-			gameID = game.ID
+func (cs *connState) setGame(gameID string) {
+	cs.mu.Lock()
+	cs.gameID = gameID
+	cs.mu.Unlock()
+}
 
-			log.Printf("Game created: Player1ID=%s, Player2ID=%s, IsBot=%v\n", game.Player1ID, game.Player2ID, game.IsBot)
+// handleFrame decodes a frame from the client and acts on it.
+func (gh *GameHandler) handleFrame(cs *connState, data []byte) {
+	// The payload is decoded and checked against the message type
+	msg, payload, err := models.ParseClientMessage(data)
+	if err != nil {
+		gh.sendError(cs.client, err)
+		return
+	}
 
-			// Store the game in game service
-			gh.gameService.StoreGame(game)
+	// Spectators are read-only
+	if cs.watching != "" && msg.Type != "watch" && msg.Type != "list-games" && msg.Type != "chat" && msg.Type != "leave" {
+		gh.sendError(cs.client, ErrSpectatorReadOnly)
+		return
+	}
 
-			// Send game state
-			message := "Game started! Your turn."
-			if game.IsBot {
-				message = "Playing against Bot. Your turn!"
-			}
+	switch msg.Type {
+	case "join":
+		join := payload.(*models.JoinPayload)
+		opts, err := join.GameOptions.Normalize()
+		if err != nil {
+			gh.sendError(cs.client, err)
+			return
+		}
+		difficulty, err := models.NormalizeDifficulty(join.Difficulty)
+		if err != nil {
+			gh.sendError(cs.client, err)
+			return
+		}
+		username := join.Username
+		gh.closeRoom(cs)
+		gh.newPlayer(cs, newPlayerID(username), username)
 
-			// Broadcast with ONLY the sender's connection to confirm receipt
-			senderResponse := models.Message{
-				Type:    "game-state",
-				GameID:  game.ID,
-				Payload: models.GameStatePayload{Game: game, PlayerID: playerID, Message: message},
-			}
-			conn.WriteJSON(senderResponse)
+		// Matchmaking
+		matched := gh.matchService.AddPlayer(cs.playerID, username, opts, difficulty)
+		gh.startGame(cs, matched)
 
-			// Broadcast to other player with delay to ensure they're ready
-			time.Sleep(100 * time.Millisecond)
-			gh.broadcastToOthers(game, playerID, message)
+	case "create-room":
+		gh.createRoom(cs, payload.(*models.CreateRoomPayload))
 
-		case "move":
-			if gameID == "" {
-				log.Println("Error: gameID is empty")
-				gh.sendError(conn, "game not started")
-				continue
-			}
+	case "join-room":
+		gh.joinRoom(cs, payload.(*models.JoinRoomPayload))
+
+	case "cancel-room":
+		gh.cancelRoom(cs)
+
+	case "rejoin":
+		rejoin := payload.(*models.RejoinPayload)
+		resumedPlayer, resumedGame, err := gh.sessions.Resume(rejoin.Token)
+		if err != nil {
+			gh.sendError(cs.client, err)
+			return
+		}
+		game, err := gh.gameService.GetGame(resumedGame)
+		if err != nil {
+			gh.sessions.Remove(resumedPlayer)
+			gh.sendError(cs.client, err)
+			return
+		}
+		gh.closeRoom(cs)
+		cs.playerID = resumedPlayer
+		cs.setGame(resumedGame)
+
+		// Take over from the old connection, if it is still open
+		gh.mu.Lock()
+		old := gh.players[cs.playerID]
+		gh.players[cs.playerID] = cs
+		gh.mu.Unlock()
+		if old != nil && old != cs {
+			old.client.Close()
+		}
+		log.Printf("Player rejoined: %s (game %s)\n", cs.playerID, cs.game())
+
+		payload := gh.statePayload(game, cs.playerID, "Reconnected")
+		payload.ResumeToken = rejoin.Token
+		cs.client.Send(models.Message{
+			Type:    "game-state",
+			GameID:  game.ID,
+			Payload: payload,
+		})
+		gh.broadcastToOthers(game, cs.playerID, "Opponent reconnected")
+
+	case "move":
+		if cs.game() == "" {
+			log.Println("Error: gameID is empty")
+			gh.sendError(cs.client, ErrGameNotStarted)
+			return
+		}
+
+		move := *payload.(*models.MovePayload)
+		log.Printf("Move: gameID=%s, playerID=%s, kind=%s, column=%d\n", cs.game(), cs.playerID, move.Kind, move.Column)
+
+		game, err := gh.gameService.PlayMove(cs.game(), cs.playerID, move)
+		if err != nil {
+			log.Printf("MakeMove error: %v\n", err)
+			gh.sendError(cs.client, err)
+			return
+		}
 
-			log.Println("Move message received. Payload:", msg.Payload)
-			payload := msg.Payload.(map[string]interface{})
-			column := int(payload["column"].(float64))
-			log.Printf("Move: gameID=%s, playerID=%s, column=%d\n", gameID, playerID, column)
+		gh.HandleMove(game, cs.playerID, move)
 
-			game, err := gh.gameService.MakeMove(gameID, playerID, column)
+	case "takeback-request":
+		if cs.game() == "" {
+			gh.sendError(cs.client, ErrGameNotStarted)
+			return
+		}
+		game, err := gh.gameService.RequestTakeback(cs.game(), cs.playerID)
+		if err != nil {
+			gh.sendError(cs.client, err)
+			return
+		}
+		// The bot accepts every takeback the rules allow
+		if game.IsBot {
+			game, err = gh.gameService.RespondTakeback(cs.game(), "bot", true)
 			if err != nil {
-				log.Printf("MakeMove error: %v\n", err)
-				gh.sendError(conn, err.Error())
-				continue
+				gh.sendError(cs.client, err)
+				return
 			}
+			gh.broadcastGameState(game, "Takeback accepted")
+			return
+		}
+		gh.broadcastGameState(game, "Takeback requested")
 
-			log.Printf("Move successful. Game status: %s, Current turn: %s\n", game.Status, game.CurrentTurn)
-			// Broadcast updated state to both players
-			gh.broadcastGameState(game, "Move accepted")
-
-			// Log event asynchronously to avoid blocking
-			go gh.analyticsService.LogMove(gameID, playerID, column)
-
-			// If bot's turn, make bot move asynchronously
-			if game.IsBot && game.Status == "active" && game.CurrentTurn == "bot" {
-				go func() {
-					time.Sleep(1 * time.Second) // Delay for better UX
-					log.Println("Making bot move...")
-					botCol := gh.botService.MakeBotMove(game)
-					log.Printf("Bot column: %d\n", botCol)
-					if botCol >= 0 {
-						updatedGame, err := gh.gameService.MakeMove(gameID, "bot", botCol)
-						if err == nil {
-							gh.broadcastGameState(updatedGame, "Bot moved")
-							go gh.analyticsService.LogMove(gameID, "bot", botCol)
-
-							// Check if game is finished
-							if updatedGame.Status != "active" {
-								gh.analyticsService.LogGameEnd(gameID, updatedGame.Winner, updatedGame.Status)
-							}
-						}
-					}
-				}()
-			} else if game.Status != "active" {
-				// Check if game is finished for human vs human
-				go gh.analyticsService.LogGameEnd(gameID, game.Winner, game.Status)
-			}
+	case "takeback-accept", "takeback-decline":
+		if cs.game() == "" {
+			gh.sendError(cs.client, ErrGameNotStarted)
+			return
+		}
+		accept := msg.Type == "takeback-accept"
+		game, err := gh.gameService.RespondTakeback(cs.game(), cs.playerID, accept)
+		if err != nil {
+			gh.sendError(cs.client, err)
+			return
+		}
+		if accept {
+			gh.broadcastGameState(game, "Takeback accepted")
+		} else {
+			gh.broadcastGameState(game, "Takeback declined")
+		}
 
-		case "leave":
-			if gameID != "" {
-				gh.analyticsService.LogGameAbandoned(gameID, playerID)
-				gh.gameService.DeleteGame(gameID)
+	case "resign":
+		if cs.game() == "" {
+			gh.sendError(cs.client, ErrGameNotStarted)
+			return
+		}
+		game, err := gh.gameService.Resign(cs.game(), cs.playerID)
+		if err != nil {
+			gh.sendError(cs.client, err)
+			return
+		}
+		gh.broadcastGameState(game, "Player resigned")
+		go gh.analyticsService.LogGameEnd(game)
+
+	case "draw-offer":
+		if cs.game() == "" {
+			gh.sendError(cs.client, ErrGameNotStarted)
+			return
+		}
+		game, err := gh.gameService.OfferDraw(cs.game(), cs.playerID)
+		if err != nil {
+			gh.sendError(cs.client, err)
+			return
+		}
+		// The bot plays every game out
+		if game.IsBot {
+			game, err = gh.gameService.RespondDraw(cs.game(), "bot", false)
+			if err != nil {
+				gh.sendError(cs.client, err)
+				return
 			}
-			break
+			gh.broadcastGameState(game, "Draw declined")
+			return
+		}
+		gh.broadcastGameState(game, "Draw offered")
+
+	case "draw-accept", "draw-decline":
+		if cs.game() == "" {
+			gh.sendError(cs.client, ErrGameNotStarted)
+			return
+		}
+		accept := msg.Type == "draw-accept"
+		game, err := gh.gameService.RespondDraw(cs.game(), cs.playerID, accept)
+		if err != nil {
+			gh.sendError(cs.client, err)
+			return
+		}
+		if accept {
+			gh.broadcastGameState(game, "Draw agreed")
+			go gh.analyticsService.LogGameEnd(game)
+		} else {
+			gh.broadcastGameState(game, "Draw declined")
+		}
+
+	case "rematch-offer":
+		if cs.game() == "" {
+			gh.sendError(cs.client, ErrGameNotStarted)
+			return
+		}
+		gh.offerRematch(cs)
+
+	case "rematch-accept", "rematch-decline":
+		if cs.game() == "" {
+			gh.sendError(cs.client, ErrGameNotStarted)
+			return
+		}
+		gh.respondRematch(cs, msg.Type == "rematch-accept")
+
+	case "hint":
+		if cs.game() == "" {
+			gh.sendError(cs.client, ErrGameNotStarted)
+			return
+		}
+		hinter, ok := gh.bot.(services.Hinter)
+		if !ok {
+			gh.sendError(cs.client, services.ErrHintsUnavailable)
+			return
+		}
+		// A hint that could not be computed is not charged
+		game, err := gh.gameService.HintPosition(cs.game(), cs.playerID)
+		if err != nil {
+			gh.sendError(cs.client, err)
+			return
+		}
+		hint, err := hinter.Hint(game)
+		if err != nil {
+			gh.sendError(cs.client, err)
+			return
+		}
+		game, err = gh.gameService.UseHint(game.ID, cs.playerID)
+		if err != nil {
+			gh.sendError(cs.client, err)
+			return
+		}
+		hint.HintsLeft = models.MaxHints - game.HintsUsed[cs.playerID]
+		cs.client.Send(models.Message{
+			Type:    "hint",
+			GameID:  game.ID,
+			Payload: hint,
+		})
+		gh.broadcastGameState(game, "Hint used")
+
+	case "watch":
+		if cs.game() != "" {
+			gh.sendError(cs.client, ErrAlreadyPlaying)
+			return
 		}
+		watch := payload.(*models.WatchPayload)
+		if err := gh.watch(cs.client, watch.GameID); err != nil {
+			gh.sendError(cs.client, err)
+			return
+		}
+		// Switching games stops watching the previous one
+		if cs.watching != "" && cs.watching != watch.GameID {
+			gh.unwatch(cs.client, cs.watching)
+		}
+		cs.watching = watch.GameID
+		cs.name = watch.Username
+
+	case "chat":
+		text := payload.(*models.ChatPayload).Text
+		switch {
+		case cs.watching != "":
+			gh.spectatorChat(cs, text)
+		case cs.game() != "":
+			gh.playerChat(cs, text)
+		default:
+			gh.sendError(cs.client, ErrGameNotStarted)
+		}
+
+	case "list-games":
+		gh.sendGameList(cs.client)
+
+	case "leave":
+		gh.closeRoom(cs)
+		if cs.watching != "" {
+			gh.unwatch(cs.client, cs.watching)
+			cs.watching = ""
+		}
+		if gameID := cs.game(); gameID != "" {
+			gh.analyticsService.LogGameAbandoned(gameID, cs.playerID)
+			gh.gameService.DeleteGame(gameID)
+			gh.sessions.Remove(cs.playerID)
+			cs.setGame("")
+		}
+		break
+	}
+}
+
+// newPlayerID returns a new player ID for username.
+func newPlayerID(username string) string {
+	return username + "_" + generateID()
+}
+
+// newPlayer makes the client playerID and registers its connection,
+// ending the session of any earlier player it had.
+func (gh *GameHandler) newPlayer(cs *connState, playerID, username string) {
+	if cs.playerID != "" {
+		gh.sessions.Remove(cs.playerID)
+		gh.mu.Lock()
+		if gh.players[cs.playerID] == cs {
+			delete(gh.players, cs.playerID)
+		}
+		gh.mu.Unlock()
+	}
+	cs.playerID = playerID
+	cs.name = username
+
+	log.Printf("Player joining: %s (playerID: %s)\n", username, cs.playerID)
+
+	// Register player IMMEDIATELY and ALWAYS
+	gh.mu.Lock()
+	gh.players[cs.playerID] = cs
+	gh.mu.Unlock()
+	log.Printf("Stored connection for playerID: %s\n", cs.playerID)
+}
+
+// startGame stores a game the client's player was matched into and sends
+// them its state. Both players call it with the same game.
+func (gh *GameHandler) startGame(cs *connState, matched *models.Game) {
+	cs.setGame(matched.ID)
+
+	log.Printf("Game created: Player1ID=%s, Player2ID=%s, IsBot=%v\n", matched.Player1ID, matched.Player2ID, matched.IsBot)
+
+	// Store the game in game service; both matched players store
+	// the same game and get back a snapshot of the stored copy
+	game, err := gh.gameService.StoreGame(matched)
+	if err != nil {
+		gh.sendError(cs.client, err)
+		return
+	}
+
+	// Send game state
+	message := "Game started! Your turn."
+	if game.IsBot {
+		message = "Playing against Bot (" + game.Difficulty + "). Your turn!"
+	}
+
+	// Send ONLY to the sender's connection, along with the token to resume
+	// the game if it drops. The opponent gets their own state when they
+	// store the game, or from startHostGame.
+	payload := gh.statePayload(game, cs.playerID, message)
+	payload.ResumeToken = gh.sessions.Create(cs.playerID, game.ID)
+	senderResponse := models.Message{
+		Type:    "game-state",
+		GameID:  game.ID,
+		Payload: payload,
+	}
+	cs.client.Send(senderResponse)
+}
+
+// disconnect cleans up after a client goes away. A player in an active
+// game keeps their seat for the reconnect grace period.
+func (gh *GameHandler) disconnect(cs *connState) {
+	gh.closeRoom(cs)
+	if cs.watching != "" {
+		gh.unwatch(cs.client, cs.watching)
 	}
 
+	// A rejoin on another connection may have taken this player over.
+	// Once the player is unregistered no one else moves it to a game, so
+	// the game read here is final.
 	gh.mu.Lock()
-	delete(gh.clients, playerID)
+	current := gh.players[cs.playerID] == cs
+	if current {
+		delete(gh.players, cs.playerID)
+	}
+	gameID := cs.game()
 	gh.mu.Unlock()
-	log.Printf("Player disconnected: %s\n", playerID)
+	if !current || cs.playerID == "" {
+		return
+	}
+	log.Printf("Player disconnected: %s\n", cs.playerID)
+
+	// Hold an active game open for the grace period
+	game, err := gh.gameService.GetGame(gameID)
+	if err != nil || game.Status != "active" {
+		gh.sessions.Remove(cs.playerID)
+		return
+	}
+	gh.sessions.Disconnect(cs.playerID)
+	gh.broadcastToOthers(game, cs.playerID, fmt.Sprintf("Opponent disconnected; they have %v to reconnect", gh.sessions.Grace()))
+}
+
+// HandleMove announces a move that playerID played, logs it and lets the
+// bot answer. It is also registered with APIHandler.SetMoveHandler for
+// moves played over the REST API.
+func (gh *GameHandler) HandleMove(game *models.Game, playerID string, move models.MovePayload) {
+	log.Printf("Move successful. Game status: %s, Current turn: %s\n", game.Status, game.CurrentTurn)
+	// Broadcast updated state to both players
+	gh.broadcastGameState(game, "Move accepted")
+
+	// Log event asynchronously to avoid blocking
+	go gh.analyticsService.LogMove(game, playerID, move)
+
+	// If bot's turn, make bot move asynchronously
+	if game.IsBot && game.Status == "active" && game.CurrentTurn == "bot" {
+		go gh.playBotMove(game)
+	} else if game.Status != "active" {
+		// Check if game is finished for human vs human
+		go gh.analyticsService.LogGameEnd(game)
+	}
 }
 
+// playBotMove plays the bot's move in game, where it is the bot's turn.
+func (gh *GameHandler) playBotMove(game *models.Game) {
+	time.Sleep(1 * time.Second) // Delay for better UX
+	log.Printf("Making bot move (%s)...\n", gh.bot.Name())
+	botMove := gh.bot.MakeBotMove(game)
+	log.Printf("Bot move: %s %d\n", botMove.Kind, botMove.Column)
+	if botMove.Column >= 0 {
+		updatedGame, err := gh.gameService.PlayMove(game.ID, "bot", botMove)
+		if err == nil {
+			gh.broadcastGameState(updatedGame, "Bot moved")
+			go gh.analyticsService.LogMove(updatedGame, "bot", botMove)
+
+			// Check if game is finished
+			if updatedGame.Status != "active" {
+				gh.analyticsService.LogGameEnd(updatedGame)
+			}
+		}
+	}
+}
+
+// forfeitAbsent ends a game that has just started for a player who
+// already left: they have no connection to come back on.
+func (gh *GameHandler) forfeitAbsent(gameID, playerID string) {
+	gh.sessions.Remove(playerID)
+	game, err := gh.gameService.Forfeit(gameID, playerID)
+	if err != nil {
+		return
+	}
+	log.Printf("Game %s: %s left before it started\n", game.ID, playerID)
+	gh.broadcastGameState(game, "Opponent left the game")
+	gh.analyticsService.LogGameEnd(game)
+}
+
+// HandleExpiredSession forfeits a game for a player who did not reconnect
+// in time. It is registered with SessionService.SetExpireHandler.
+func (gh *GameHandler) HandleExpiredSession(playerID, gameID string) {
+	game, err := gh.gameService.Forfeit(gameID, playerID)
+	if err != nil {
+		return
+	}
+	log.Printf("Game %s: %s did not reconnect and forfeits\n", game.ID, playerID)
+	gh.broadcastGameState(game, "Opponent left the game")
+	gh.analyticsService.LogGameEnd(game)
+}
+
+// broadcastGameState sends the game state to both players and everyone
+// watching.
 func (gh *GameHandler) broadcastGameState(game *models.Game, message string) {
-	gh.mu.RLock()
-	conn1 := gh.clients[game.Player1ID]
-	conn2 := gh.clients[game.Player2ID]
-	gh.mu.RUnlock()
+	gh.sendToPlayers(game, message)
+	gh.sendToSpectators(game, message)
+}
+
+func (gh *GameHandler) sendToPlayers(game *models.Game, message string) {
+	client1 := gh.client(game.Player1ID)
+	client2 := gh.client(game.Player2ID)
 
-	if conn1 != nil {
+	if client1 != nil {
 		response := models.Message{
 			Type:    "game-state",
 			GameID:  game.ID,
-			Payload: models.GameStatePayload{Game: game, PlayerID: game.Player1ID, Message: message},
+			Payload: gh.statePayload(game, game.Player1ID, message),
 		}
-		if err := conn1.WriteJSON(response); err != nil {
-			log.Printf("Error writing to Player1: %v\n", err)
+		if !client1.Send(response) {
+			log.Printf("Error sending to Player1 %s\n", game.Player1ID)
 		}
 	}
-	if conn2 != nil && game.Player2ID != "bot" {
+	if client2 != nil && game.Player2ID != "bot" {
 		response := models.Message{
 			Type:    "game-state",
 			GameID:  game.ID,
-			Payload: models.GameStatePayload{Game: game, PlayerID: game.Player2ID, Message: message},
+			Payload: gh.statePayload(game, game.Player2ID, message),
 		}
-		if err := conn2.WriteJSON(response); err != nil {
-			log.Printf("Error writing to Player2: %v\n", err)
+		if !client2.Send(response) {
+			log.Printf("Error sending to Player2 %s\n", game.Player2ID)
 		}
 	}
 }
 
+// HandleTimeout announces a game lost on time. It is registered with
+// GameService.SetTimeoutHandler.
+func (gh *GameHandler) HandleTimeout(game *models.Game) {
+	log.Printf("Game %s: %s ran out of time\n", game.ID, game.CurrentTurn)
+	gh.broadcastGameState(game, "Time out")
+	gh.analyticsService.LogGameEnd(game)
+}
+
 func (gh *GameHandler) broadcastToOthers(game *models.Game, senderID string, message string) {
-	gh.mu.RLock()
 	var otherID string
-	var otherConn *websocket.Conn
-
-	if senderID == game.Player1ID && game.Player2ID != "bot" {
+	if senderID == game.Player1ID {
 		otherID = game.Player2ID
-		otherConn = gh.clients[game.Player2ID]
 	} else if senderID == game.Player2ID {
 		otherID = game.Player1ID
-		otherConn = gh.clients[game.Player1ID]
 	}
-	gh.mu.RUnlock()
+	// The bot may be either player since rematches swap colors
+	if otherID == "bot" {
+		return
+	}
+	other := gh.client(otherID)
 
-	if otherConn != nil {
+	if other != nil {
 		response := models.Message{
 			Type:    "game-state",
 			GameID:  game.ID,
-			Payload: models.GameStatePayload{Game: game, PlayerID: otherID, Message: message},
+			Payload: gh.statePayload(game, otherID, message),
 		}
-		if err := otherConn.WriteJSON(response); err != nil {
-			log.Printf("Error writing to other player: %v\n", err)
+		if !other.Send(response) {
+			log.Printf("Error sending to other player %s\n", otherID)
 		}
 	} else {
 		log.Printf("Other player connection not found. Sender: %s, Game: P1=%s P2=%s\n", senderID, game.Player1ID, game.Player2ID)
 	}
 }
 
-func (gh *GameHandler) sendError(conn *websocket.Conn, errMsg string) {
+// client returns the connection of playerID, or nil if they have none.
+func (gh *GameHandler) client(playerID string) *Client {
+	gh.mu.RLock()
+	defer gh.mu.RUnlock()
+	if cs := gh.players[playerID]; cs != nil {
+		return cs.client
+	}
+	return nil
+}
+
+// moveToGame sets the game of playerID's connection, from any goroutine.
+// It reports false if the player has no connection.
+func (gh *GameHandler) moveToGame(playerID, gameID string) bool {
+	gh.mu.Lock()
+	defer gh.mu.Unlock()
+	cs := gh.players[playerID]
+	if cs == nil {
+		return false
+	}
+	cs.setGame(gameID)
+	return true
+}
+
+// statePayload is the game state for playerID, or for a spectator if
+// playerID is empty, with the current spectator count.
+func (gh *GameHandler) statePayload(game *models.Game, playerID, message string) models.GameStatePayload {
+	if playerID != "" {
+		game = game.PlayerView()
+	}
+	payload := models.NewGameStatePayload(game, playerID, message)
+	payload.Spectators = gh.spectatorCount(game.ID)
+	return payload
+}
+
+// sendError reports err to the client with its protocol error code.
+func (gh *GameHandler) sendError(client *Client, err error) {
 	response := models.Message{
-		Type:    "error",
-		Payload: map[string]string{"error": errMsg},
+		Type: "error",
+		Payload: models.ErrorPayload{
+			Code:  errorCode(err),
+			Error: err.Error(),
+		},
+	}
+	client.Send(response)
+}
+
+// supportsAny reports whether one of the requested subprotocols is a
+// protocol version the server speaks.
+func supportsAny(subprotocols []string) bool {
+	for _, p := range subprotocols {
+		if _, ok := models.ParseSubprotocol(p); ok {
+			return true
+		}
 	}
-	conn.WriteJSON(response)
+	return false
 }
 
 func generateID() string {
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"4-in-a-row/models"
+	"4-in-a-row/services"
+
+	"github.com/gorilla/websocket"
+)
+
+// newTestHandler returns a game handler with in-memory services, as
+// main wires them.
+func newTestHandler() (*GameHandler, *services.GameService, *services.SessionService) {
+	return newTestHandlerGrace(time.Minute)
+}
+
+// newTestHandlerGrace is newTestHandler with the given reconnect grace
+// period.
+func newTestHandlerGrace(grace time.Duration) (*GameHandler, *services.GameService, *services.SessionService) {
+	gs := services.NewGameService()
+	ss := services.NewSessionService(grace)
+	gh := NewGameHandler(gs, services.NewBotService(gs, 10*time.Millisecond),
+		services.NewMatchmakingService(10), services.NewAnalyticsService(nil), ss,
+		services.NewChatService(200, 10, nil), services.NewRoomService(time.Minute))
+	gs.SetTimeoutHandler(gh.HandleTimeout)
+	ss.SetExpireHandler(gh.HandleExpiredSession)
+	return gh, gs, ss
+}
+
+func dialGame(t *testing.T, url string, protocols ...string) (*websocket.Conn, *http.Response, error) {
+	t.Helper()
+	dialer := websocket.Dialer{Subprotocols: protocols, HandshakeTimeout: 5 * time.Second}
+	conn, resp, err := dialer.Dial("ws"+strings.TrimPrefix(url, "http"), nil)
+	if conn != nil {
+		t.Cleanup(func() { conn.Close() })
+	}
+	return conn, resp, err
+}
+
+// readMessage reads the next message, with its payload left raw.
+func readMessage(t *testing.T, conn *websocket.Conn) (msgType string, payload json.RawMessage) {
+	t.Helper()
+	var msg struct {
+		Type    string          `json:"type"`
+		Payload json.RawMessage `json:"payload"`
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatal(err)
+	}
+	return msg.Type, msg.Payload
+}
+
+func TestSubprotocolNegotiation(t *testing.T) {
+	gh, _, _ := newTestHandler()
+	srv := httptest.NewServer(http.HandlerFunc(gh.HandleWebSocket))
+	defer srv.Close()
+
+	tests := []struct {
+		name      string
+		protocols []string
+		version   int
+	}{
+		{"none requested", nil, models.MinProtocolVersion},
+		{"newest", []string{models.Subprotocol(models.ProtocolVersion)}, models.ProtocolVersion},
+		{"one of several", []string{"chat", models.Subprotocol(models.MinProtocolVersion)}, models.MinProtocolVersion},
+	}
+	for _, tt := range tests {
+		conn, _, err := dialGame(t, srv.URL, tt.protocols...)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if len(tt.protocols) > 0 && conn.Subprotocol() != models.Subprotocol(tt.version) {
+			t.Errorf("%s: subprotocol %q", tt.name, conn.Subprotocol())
+		}
+		msgType, payload := readMessage(t, conn)
+		var hello models.HelloPayload
+		if err := json.Unmarshal(payload, &hello); msgType != "hello" || err != nil || hello.Version != tt.version {
+			t.Errorf("%s: got %s %s, want hello with version %d", tt.name, msgType, payload, tt.version)
+		}
+	}
+}
+
+func TestUnknownSubprotocolRejected(t *testing.T) {
+	gh, _, _ := newTestHandler()
+	srv := httptest.NewServer(http.HandlerFunc(gh.HandleWebSocket))
+	defer srv.Close()
+
+	for _, protocols := range [][]string{
+		{models.Subprotocol(models.ProtocolVersion + 1)},
+		{"chat", "connect4.vx"},
+	} {
+		_, resp, err := dialGame(t, srv.URL, protocols...)
+		if err == nil {
+			t.Errorf("%v: connection accepted", protocols)
+			continue
+		}
+		if resp == nil || resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%v: %v, want status 400", protocols, err)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/events?protocol="+models.Subprotocol(models.ProtocolVersion+1), nil)
+	gh.HandleEvents(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("event stream with an unknown protocol: status %d, want 400", rec.Code)
+	}
+}
+
+// TestInvalidFrames checks that frames the protocol rejects get an error
+// with its code and leave the connection open.
+func TestInvalidFrames(t *testing.T) {
+	gh, _, _ := newTestHandler()
+	srv := httptest.NewServer(http.HandlerFunc(gh.HandleWebSocket))
+	defer srv.Close()
+	conn, _, err := dialGame(t, srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	readMessage(t, conn) // hello
+
+	tests := []struct {
+		frame, code string
+	}{
+		{`{"type":"join","payload":{"username":"a","colour":"red"}}`, models.ErrCodeInvalidPayload},
+		{`{"type":"move","payload":{"column":"3"}}`, models.ErrCodeInvalidPayload},
+		{`{"type":"teleport"}`, models.ErrCodeUnknownMessageType},
+		{`not json`, models.ErrCodeMalformedMessage},
+		{`{"type":"move","payload":{"column":3}}`, models.ErrCodeGameNotStarted},
+	}
+	for _, tt := range tests {
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(tt.frame)); err != nil {
+			t.Fatal(err)
+		}
+		msgType, payload := readMessage(t, conn)
+		var e models.ErrorPayload
+		if err := json.Unmarshal(payload, &e); msgType != "error" || err != nil || e.Code != tt.code {
+			t.Errorf("%s: got %s %s, want error %s", tt.frame, msgType, payload, tt.code)
+		}
+	}
+}
+
+// TestMatchStart pairs two players, who each get one state for the new
+// game, with their own resume token, before any other.
+func TestMatchStart(t *testing.T) {
+	gh, _, _ := newTestHandler()
+	srv := httptest.NewServer(http.HandlerFunc(gh.HandleWebSocket))
+	defer srv.Close()
+	first, second := connect(t, srv), connect(t, srv)
+
+	sendMessage(t, first, "join", models.JoinPayload{Username: "first"})
+	time.Sleep(50 * time.Millisecond) // let the first player wait in the queue
+	sendMessage(t, second, "join", models.JoinPayload{Username: "second"})
+	var states [2]*models.GameStatePayload
+	for i, conn := range []*websocket.Conn{first, second} {
+		msgType, payload := readMessage(t, conn)
+		if msgType != "game-state" {
+			t.Fatalf("player %d got %s first, want game-state", i+1, msgType)
+		}
+		states[i] = &models.GameStatePayload{}
+		if err := json.Unmarshal(payload, states[i]); err != nil {
+			t.Fatal(err)
+		}
+		if states[i].ResumeToken == "" {
+			t.Errorf("player %d's first state has no resume token", i+1)
+		}
+	}
+	if states[0].Game.ID != states[1].Game.ID || states[0].Game.IsBot {
+		t.Fatalf("players in %s and %s", states[0].Game.ID, states[1].Game.ID)
+	}
+
+	// The next state each sees is the first move, not a second start
+	sendMessage(t, first, "move", models.MovePayload{Column: 3})
+	for i, conn := range []*websocket.Conn{first, second} {
+		msgType, payload := readMessage(t, conn)
+		var state models.GameStatePayload
+		if err := json.Unmarshal(payload, &state); msgType != "game-state" || err != nil || len(state.Game.Moves) != 1 {
+			t.Errorf("player %d got %s %s, want the move", i+1, msgType, payload)
+		}
+	}
+}
@@ -3,7 +3,9 @@ package main
 import (
 	"log"
 	"net/http"
+	"time"
 
+	"4-in-a-row/book"
 	"4-in-a-row/config"
 	"4-in-a-row/handlers"
 	"4-in-a-row/services"
@@ -16,8 +18,36 @@ func main() {
 
 	// Initialize services
 	gameService := services.NewGameService()
-	botService := services.NewBotService(gameService)
+	botMoveTime := time.Duration(cfg.BotMoveTimeMs) * time.Millisecond
+	botService := services.NewBotService(gameService, botMoveTime)
+	if cfg.BotBook != "" {
+		openingBook, err := book.Open(cfg.BotBook)
+		if err != nil {
+			log.Printf("Opening book not loaded: %v\n", err)
+		} else {
+			botService.SetBook(openingBook, cfg.BotBookPlies)
+			log.Printf("Loaded opening book %s (%d positions)\n", cfg.BotBook, openingBook.Len())
+		}
+	}
 	matchmakingService := services.NewMatchmakingService(cfg.MatchmakingTimeout)
+	sessionService := services.NewSessionService(time.Duration(cfg.ReconnectGrace) * time.Second)
+	roomService := services.NewRoomService(time.Duration(cfg.RoomTimeout) * time.Second)
+	var chatFilter []string
+	if cfg.ChatFilterFile != "" {
+		words, err := services.LoadWordList(cfg.ChatFilterFile)
+		if err != nil {
+			log.Printf("Chat filter not loaded: %v\n", err)
+		} else {
+			chatFilter = words
+		}
+	}
+	chatService := services.NewChatService(cfg.ChatMaxLength, cfg.ChatPerMinute, chatFilter)
+
+	// Bot games use the external engine when one is configured
+	var bot services.Bot = botService
+	if len(cfg.BotEngine) > 0 {
+		bot = services.NewExternalBot(cfg.BotEngine, botMoveTime, cfg.BotEngineProcesses, botService)
+	}
 
 	// Initialize Kafka (disabled for now - causing delays)
 	var analyticsService *services.AnalyticsService
@@ -29,7 +59,11 @@ func main() {
 	analyticsService = services.NewAnalyticsService(nil)
 
 	// Initialize handler
-	gameHandler := handlers.NewGameHandler(gameService, botService, matchmakingService, analyticsService)
+	gameHandler := handlers.NewGameHandler(gameService, bot, matchmakingService, analyticsService, sessionService, chatService, roomService)
+	gameService.SetTimeoutHandler(gameHandler.HandleTimeout)
+	sessionService.SetExpireHandler(gameHandler.HandleExpiredSession)
+	apiHandler := handlers.NewAPIHandler(gameService, matchmakingService, sessionService)
+	apiHandler.SetMoveHandler(gameHandler.HandleMove)
 
 	// Set up routes
 	router := mux.NewRouter()
@@ -37,6 +71,13 @@ func main() {
 	// WebSocket endpoint
 	router.HandleFunc("/ws", gameHandler.HandleWebSocket)
 
+	// Server-Sent Events fallback for networks that break WebSockets
+	router.HandleFunc("/events", gameHandler.HandleEvents).Methods(http.MethodGet)
+	router.HandleFunc("/events/{id}", gameHandler.HandleEventPost).Methods(http.MethodPost)
+
+	// REST API
+	apiHandler.Register(router)
+
 	// Static files
 	router.PathPrefix("/").Handler(http.FileServer(http.Dir("./frontend")))
 
@@ -0,0 +1,318 @@
+// Package mcts is a Monte Carlo tree search player for Connect-N. Unlike
+// the solver it needs no evaluation function and handles PopOut, so it
+// plays reasonably on any board the engine supports. Searches run for a
+// wall-clock budget on several goroutines, and the trees are kept between
+// moves so work done on earlier turns is reused.
+package mcts
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"4-in-a-row/engine"
+)
+
+const (
+	// exploration is the UCT exploration constant.
+	exploration = 1.2
+	// maxNodes bounds each worker's tree; once it is reached the search
+	// keeps refining the statistics of the nodes it already has.
+	maxNodes = 1 << 19
+	// clockCheck is how many iterations run between deadline checks.
+	clockCheck = 64
+)
+
+var ErrGameOver = errors.New("position is already decided")
+
+// Move is a drop, or a pop in PopOut.
+type Move struct {
+	Column int
+	Pop    bool
+}
+
+// Result describes the move chosen by a search.
+type Result struct {
+	Move     Move
+	Visits   int     // playouts through the chosen move
+	Playouts int     // playouts in this search, all workers together
+	WinRate  float64 // expected score of the chosen move, 0 to 1
+}
+
+// Searcher holds one tree per worker, all rooted at the same position.
+// Workers search independently and their root statistics are merged when
+// the search ends, so no locking is needed while searching. A Searcher is
+// not safe for concurrent use.
+type Searcher struct {
+	pos     engine.Position
+	popout  bool
+	workers []*worker
+}
+
+type worker struct {
+	root  *node
+	nodes int
+	rng   *rand.Rand
+	path  []*node // scratch space for iterate
+}
+
+// node is a position in the tree, reached by move. score and visits are
+// from the point of view of player, who made the move.
+type node struct {
+	move     Move
+	player   int
+	children []*node
+	untried  []Move
+	terminal bool
+	winner   int // for terminal nodes: 1, 2 or 0 for a draw
+	visits   int
+	score    float64
+}
+
+// New returns a searcher for pos with the given number of workers (at
+// least one). popout enables PopOut moves.
+func New(pos *engine.Position, popout bool, workers int) *Searcher {
+	if workers < 1 {
+		workers = 1
+	}
+	s := &Searcher{pos: *pos, popout: popout}
+	seed := time.Now().UnixNano()
+	for i := 0; i < workers; i++ {
+		w := &worker{rng: rand.New(rand.NewSource(seed + int64(i)))}
+		w.root = s.newNode(Move{Column: -1}, 3-pos.ToMove(), &s.pos)
+		w.nodes = 1
+		s.workers = append(s.workers, w)
+	}
+	return s
+}
+
+// Position returns the position at the root of the trees.
+func (s *Searcher) Position() engine.Position { return s.pos }
+
+// Advance plays m at the root. The matching subtree of every worker
+// becomes its new tree and the rest is dropped. It returns false, leaving
+// the searcher unchanged, if m is not legal.
+func (s *Searcher) Advance(m Move) bool {
+	if s.pos.Winner() != 0 || !s.legal(&s.pos, m) {
+		return false
+	}
+	mover := s.pos.ToMove()
+	s.play(&s.pos, m)
+	for _, w := range s.workers {
+		var next *node
+		for _, c := range w.root.children {
+			if c.move == m {
+				next = c
+				break
+			}
+		}
+		if next == nil {
+			next = s.newNode(m, mover, &s.pos)
+		}
+		w.root = next
+		w.nodes = next.size()
+	}
+	return true
+}
+
+// Search runs playouts until budget has passed and returns the move with
+// the most visits across all workers.
+func (s *Searcher) Search(budget time.Duration) (Result, error) {
+	if s.workers[0].root.terminal {
+		return Result{Move: Move{Column: -1}}, ErrGameOver
+	}
+	deadline := time.Now().Add(budget)
+
+	playouts := make([]int, len(s.workers))
+	var wg sync.WaitGroup
+	for i, w := range s.workers {
+		wg.Add(1)
+		go func(i int, w *worker) {
+			defer wg.Done()
+			for n := 0; ; n++ {
+				if n%clockCheck == 0 && n > 0 && time.Now().After(deadline) {
+					playouts[i] = n
+					return
+				}
+				s.iterate(w)
+			}
+		}(i, w)
+	}
+	wg.Wait()
+
+	type stats struct {
+		visits int
+		score  float64
+	}
+	merged := make(map[Move]*stats)
+	var order []Move
+	for _, w := range s.workers {
+		for _, c := range w.root.children {
+			st := merged[c.move]
+			if st == nil {
+				st = &stats{}
+				merged[c.move] = st
+				order = append(order, c.move)
+			}
+			st.visits += c.visits
+			st.score += c.score
+		}
+	}
+
+	r := Result{Move: Move{Column: -1}}
+	for _, n := range playouts {
+		r.Playouts += n
+	}
+	for _, m := range order {
+		st := merged[m]
+		if r.Move.Column == -1 || st.visits > r.Visits {
+			r.Move, r.Visits = m, st.visits
+			r.WinRate = st.score / float64(st.visits)
+		}
+	}
+	return r, nil
+}
+
+// iterate runs one selection, expansion, playout and backup.
+func (s *Searcher) iterate(w *worker) {
+	pos := s.pos
+	path := append(w.path[:0], w.root)
+	defer func() { w.path = path }()
+	n := w.root
+
+	// Selection: descend through fully expanded nodes.
+	for !n.terminal && len(n.untried) == 0 && len(n.children) > 0 {
+		n = n.bestChild()
+		s.play(&pos, n.move)
+		path = append(path, n)
+	}
+
+	// Expansion: add one untried move while the tree has room.
+	if !n.terminal && len(n.untried) > 0 && w.nodes < maxNodes {
+		i := w.rng.Intn(len(n.untried))
+		m := n.untried[i]
+		n.untried[i] = n.untried[len(n.untried)-1]
+		n.untried = n.untried[:len(n.untried)-1]
+		mover := pos.ToMove()
+		s.play(&pos, m)
+		child := s.newNode(m, mover, &pos)
+		n.children = append(n.children, child)
+		w.nodes++
+		n = child
+		path = append(path, n)
+	}
+
+	winner := n.winner
+	if !n.terminal {
+		winner = s.playout(pos, w.rng)
+	}
+	for _, p := range path {
+		p.visits++
+		switch winner {
+		case p.player:
+			p.score++
+		case 0:
+			p.score += 0.5
+		}
+	}
+}
+
+// playout plays random moves to the end of the game and returns the
+// winner, or 0 for a draw. It takes an immediate win and blocks an
+// immediate loss when it sees one, which makes the results far less noisy
+// than pure random play for little cost.
+func (s *Searcher) playout(pos engine.Position, rng *rand.Rand) int {
+	// PopOut games can go on forever; call long ones a draw.
+	limit := 4 * pos.Rows() * pos.Columns()
+	var moves [2 * engine.MaxColumns]Move
+	for ply := 0; ply < limit; ply++ {
+		if pos.Winner() != 0 {
+			return pos.Winner()
+		}
+		me := pos.ToMove()
+		possible := pos.Possible()
+		if pos.WinningCells(me)&possible != 0 {
+			return me
+		}
+		if threats := pos.WinningCells(3-me) & possible; threats != 0 {
+			pos.Play(pos.ColumnOf(threats & -threats))
+			continue
+		}
+		n := s.legalMoves(&pos, moves[:0])
+		if len(n) == 0 {
+			return 0
+		}
+		s.play(&pos, n[rng.Intn(len(n))])
+	}
+	return 0
+}
+
+// newNode returns the node for pos, reached by player playing m.
+func (s *Searcher) newNode(m Move, player int, pos *engine.Position) *node {
+	n := &node{move: m, player: player}
+	if pos.Winner() != 0 {
+		n.terminal, n.winner = true, pos.Winner()
+		return n
+	}
+	n.untried = s.legalMoves(pos, nil)
+	if len(n.untried) == 0 {
+		n.terminal = true
+	}
+	return n
+}
+
+// bestChild picks the child with the highest UCT value.
+func (n *node) bestChild() *node {
+	logN := math.Log(float64(n.visits))
+	var best *node
+	bestValue := math.Inf(-1)
+	for _, c := range n.children {
+		v := c.score/float64(c.visits) + exploration*math.Sqrt(logN/float64(c.visits))
+		if v > bestValue {
+			best, bestValue = c, v
+		}
+	}
+	return best
+}
+
+// size counts the nodes in the subtree.
+func (n *node) size() int {
+	total := 1
+	for _, c := range n.children {
+		total += c.size()
+	}
+	return total
+}
+
+func (s *Searcher) legalMoves(pos *engine.Position, moves []Move) []Move {
+	for col := 0; col < pos.Columns(); col++ {
+		if pos.CanPlay(col) {
+			moves = append(moves, Move{Column: col})
+		}
+	}
+	if s.popout {
+		for col := 0; col < pos.Columns(); col++ {
+			if pos.CanPop(col) {
+				moves = append(moves, Move{Column: col, Pop: true})
+			}
+		}
+	}
+	return moves
+}
+
+func (s *Searcher) legal(pos *engine.Position, m Move) bool {
+	if m.Pop {
+		return s.popout && pos.CanPop(m.Column)
+	}
+	return pos.CanPlay(m.Column)
+}
+
+func (s *Searcher) play(pos *engine.Position, m Move) {
+	if m.Pop {
+		pos.Pop(m.Column)
+	} else {
+		pos.Play(m.Column)
+	}
+}
@@ -0,0 +1,87 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// MaxClockSeconds bounds every time control setting.
+const MaxClockSeconds = 3 * 60 * 60
+
+var ErrInvalidTimeControl = errors.New("invalid time control")
+
+// TimeControl configures the game clocks. The zero value means untimed.
+// Initial/Increment give chess-style Fischer clocks such as 3+2
+// (Initial 180, Increment 2); PerMove instead gives each player a fresh
+// budget for every move.
+type TimeControl struct {
+	Initial   int `json:"initial,omitempty"`   // seconds on each clock at the start
+	Increment int `json:"increment,omitempty"` // seconds added after each move
+	PerMove   int `json:"per_move,omitempty"`  // seconds per move, replaces Initial/Increment
+}
+
+// Timed reports whether the time control uses clocks at all.
+func (tc TimeControl) Timed() bool {
+	return tc.Initial > 0 || tc.PerMove > 0
+}
+
+// Validate checks that the settings are in range and not mixed.
+func (tc TimeControl) Validate() error {
+	if tc.Initial < 0 || tc.Increment < 0 || tc.PerMove < 0 ||
+		tc.Initial > MaxClockSeconds || tc.Increment > MaxClockSeconds || tc.PerMove > MaxClockSeconds {
+		return ErrInvalidTimeControl
+	}
+	if tc.PerMove > 0 && (tc.Initial > 0 || tc.Increment > 0) {
+		return ErrInvalidTimeControl
+	}
+	if tc.Increment > 0 && tc.Initial == 0 {
+		return ErrInvalidTimeControl
+	}
+	return nil
+}
+
+// StartingTime is what each clock shows before the first move.
+func (tc TimeControl) StartingTime() time.Duration {
+	if tc.PerMove > 0 {
+		return time.Duration(tc.PerMove) * time.Second
+	}
+	return time.Duration(tc.Initial) * time.Second
+}
+
+// Clock is the live state of both clocks, sent with every game-state.
+type Clock struct {
+	Player1Ms int64  `json:"player1_ms"`
+	Player2Ms int64  `json:"player2_ms"`
+	Running   string `json:"running,omitempty"` // player whose clock is ticking
+}
+
+// ClockAt returns both players' remaining time at now, or nil for
+// untimed games.
+func (g *Game) ClockAt(now time.Time) *Clock {
+	if !g.TimeControl.Timed() {
+		return nil
+	}
+	clock := &Clock{Player1Ms: g.Player1TimeMs, Player2Ms: g.Player2TimeMs}
+	if g.Status != "active" || g.TurnStartedAt.IsZero() {
+		return clock
+	}
+	clock.Running = g.CurrentTurn
+	if g.CurrentTurn == g.Player1ID {
+		clock.Player1Ms = max(0, clock.Player1Ms-now.Sub(g.TurnStartedAt).Milliseconds())
+	} else {
+		clock.Player2Ms = max(0, clock.Player2Ms-now.Sub(g.TurnStartedAt).Milliseconds())
+	}
+	return clock
+}
+
+// RemainingFor returns how long playerID has left at now.
+func (g *Game) RemainingFor(playerID string, now time.Time) time.Duration {
+	clock := g.ClockAt(now)
+	if clock == nil {
+		return 0
+	}
+	if playerID == g.Player1ID {
+		return time.Duration(clock.Player1Ms) * time.Millisecond
+	}
+	return time.Duration(clock.Player2Ms) * time.Millisecond
+}
@@ -1,6 +1,47 @@
 package models
 
-import "time"
+import (
+	"errors"
+	"time"
+)
+
+// Default board geometry: the classic 6x7 Connect Four.
+const (
+	DefaultRows      = 6
+	DefaultColumns   = 7
+	DefaultWinLength = 4
+
+	MinBoardSize = 4
+	MaxBoardSize = 10
+	MinWinLength = 3
+
+	// MaxBoardBits caps (rows+1)*columns: the engine packs each column
+	// plus one sentinel cell into a 64-bit bitboard.
+	MaxBoardBits = 64
+)
+
+// Rule variants.
+const (
+	VariantStandard = "standard"
+	VariantPopOut   = "popout" // players may also pop their own disc from the bottom row
+)
+
+// Bot difficulty levels.
+const (
+	DifficultyEasy    = "easy"    // heuristic play with frequent random blunders
+	DifficultyMedium  = "medium"  // shallow search
+	DifficultyHard    = "hard"    // deep search
+	DifficultyPerfect = "perfect" // full solve
+	DifficultyMCTS    = "mcts"    // Monte Carlo tree search, any variant
+
+	DefaultDifficulty = DifficultyMedium
+)
+
+var (
+	ErrInvalidBoardSize  = errors.New("invalid board size")
+	ErrInvalidVariant    = errors.New("invalid variant")
+	ErrInvalidDifficulty = errors.New("invalid difficulty")
+)
 
 type Game struct {
 	ID          string    `json:"id"`
@@ -8,20 +49,322 @@ type Game struct {
 	Player2ID   string    `json:"player2_id"`
 	Player1Name string    `json:"player1_name"`
 	Player2Name string    `json:"player2_name"`
-	Board       [6][7]int `json:"board"` // 6 rows and 7 columns
+	Rows        int       `json:"rows"`
+	Columns     int       `json:"columns"`
+	WinLength   int       `json:"win_length"`
+	Variant     string    `json:"variant"`
+	Board       [][]int   `json:"board"` // Rows x Columns, row 0 is the top
 	CurrentTurn string    `json:"current_turn"`
-	Status      string    `json:"status"` // "active", "won", "draw"
+	Status      string    `json:"status"` // "active", "won", "draw", "timeout", "resigned", "agreed-draw", "abandoned"
 	Winner      string    `json:"winner"` // ID of the winning player
 	IsBot       bool      `json:"is_bot"`
+	Difficulty  string    `json:"difficulty,omitempty"` // bot games only
+	Private     bool      `json:"private,omitempty"`    // played in a private room
+	Unrated     bool      `json:"unrated,omitempty"`    // the players chose an unrated game
+	Moves       []Move    `json:"moves"`                // every accepted move, in order
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
+
+	// Clocks: remaining time for each player as of TurnStartedAt, when
+	// the player to move started thinking. Unused for untimed games.
+	TimeControl   TimeControl `json:"time_control"`
+	Player1TimeMs int64       `json:"player1_time_ms"`
+	Player2TimeMs int64       `json:"player2_time_ms"`
+	TurnStartedAt time.Time   `json:"turn_started_at"`
+
+	// TakebackRequestedBy is the player waiting for the opponent to answer
+	// a takeback request, if any.
+	TakebackRequestedBy string `json:"takeback_requested_by,omitempty"`
+
+	// DrawOfferedBy is the player whose draw offer awaits an answer, if any.
+	DrawOfferedBy string `json:"draw_offered_by,omitempty"`
+
+	// RematchOfferedBy is the player whose rematch offer awaits an answer,
+	// and RematchID the game that was started once it was accepted.
+	RematchOfferedBy string `json:"rematch_offered_by,omitempty"`
+	RematchID        string `json:"rematch_id,omitempty"`
+
+	// Series is the score of the earlier games between the same players,
+	// for rematches. It is nil for a game that is not a rematch.
+	Series *SeriesScore `json:"series,omitempty"`
+
+	// WinningLines are the winner's completed lines, as cells, and
+	// WinningMove is the move that completed them. Both are empty unless
+	// the game was won on the board.
+	WinningLines [][]Cell `json:"winning_lines,omitempty"`
+	WinningMove  *Move    `json:"winning_move,omitempty"`
+
+	// HintsUsed counts each player's hints. Games with any hints are
+	// unrated.
+	HintsUsed map[string]int `json:"hints_used,omitempty"`
+
+	// Chat is every chat message sent in the game, the players' and the
+	// spectators', after filtering.
+	Chat []ChatMessage `json:"chat,omitempty"`
+
+	// PositionCounts tracks how often each position occurred, for the
+	// PopOut threefold repetition draw.
+	PositionCounts map[uint64]int `json:"-"`
+}
+
+// Cell is a board cell; row 0 is the top, as in Board.
+type Cell struct {
+	Row    int `json:"row"`
+	Column int `json:"column"`
+}
+
+// MaxHints is how many hints each player may ask for in a game.
+const MaxHints = 3
+
+// ChatMessage is a chat line as stored with the game and sent to clients.
+type ChatMessage struct {
+	From      string    `json:"from,omitempty"` // player ID, empty for spectators
+	Name      string    `json:"name"`
+	Text      string    `json:"text"`
+	Spectator bool      `json:"spectator,omitempty"` // only spectators see it
+	SentAt    time.Time `json:"sent_at"`
+}
+
+// SeriesScore is the running score of a series of rematches.
+type SeriesScore struct {
+	Games int            `json:"games"` // finished games
+	Wins  map[string]int `json:"wins"`  // by player ID
+	Draws int            `json:"draws"`
+}
+
+// GameOptions are the settings a player picks when joining. Two players
+// are only matched when their options are equal.
+type GameOptions struct {
+	Rows      int    `json:"rows,omitempty"`
+	Columns   int    `json:"columns,omitempty"`
+	WinLength int    `json:"win_length,omitempty"`
+	Variant   string `json:"variant,omitempty"`
+
+	TimeControl TimeControl `json:"time_control,omitempty"`
+}
+
+// DefaultGameOptions returns the options for a standard game.
+func DefaultGameOptions() GameOptions {
+	return GameOptions{
+		Rows:      DefaultRows,
+		Columns:   DefaultColumns,
+		WinLength: DefaultWinLength,
+		Variant:   VariantStandard,
+	}
+}
+
+// Normalize fills unset fields with the defaults and validates the result.
+func (o GameOptions) Normalize() (GameOptions, error) {
+	if o.Rows == 0 {
+		o.Rows = DefaultRows
+	}
+	if o.Columns == 0 {
+		o.Columns = DefaultColumns
+	}
+	if o.WinLength == 0 {
+		o.WinLength = DefaultWinLength
+	}
+	if o.Variant == "" {
+		o.Variant = VariantStandard
+	}
+	if o.Variant != VariantStandard && o.Variant != VariantPopOut {
+		return o, ErrInvalidVariant
+	}
+	if o.Rows < MinBoardSize || o.Rows > MaxBoardSize ||
+		o.Columns < MinBoardSize || o.Columns > MaxBoardSize ||
+		(o.Rows+1)*o.Columns > MaxBoardBits {
+		return o, ErrInvalidBoardSize
+	}
+	if o.WinLength < MinWinLength || (o.WinLength > o.Rows && o.WinLength > o.Columns) {
+		return o, ErrInvalidBoardSize
+	}
+	if err := o.TimeControl.Validate(); err != nil {
+		return o, err
+	}
+	return o, nil
+}
+
+// NormalizeDifficulty defaults an empty difficulty and validates it.
+func NormalizeDifficulty(difficulty string) (string, error) {
+	switch difficulty {
+	case "":
+		return DefaultDifficulty, nil
+	case DifficultyEasy, DifficultyMedium, DifficultyHard, DifficultyPerfect, DifficultyMCTS:
+		return difficulty, nil
+	}
+	return difficulty, ErrInvalidDifficulty
+}
+
+// NewBoard allocates an empty rows x columns board.
+func NewBoard(rows, columns int) [][]int {
+	board := make([][]int, rows)
+	for r := range board {
+		board[r] = make([]int, columns)
+	}
+	return board
+}
+
+// CopyBoard returns a deep copy of board.
+func CopyBoard(board [][]int) [][]int {
+	cp := make([][]int, len(board))
+	for r := range board {
+		cp[r] = append([]int(nil), board[r]...)
+	}
+	return cp
+}
+
+// NewGame builds an active game between two players using opts, which
+// must already be normalized.
+func NewGame(id, player1ID, player1Name, player2ID, player2Name string, isBot bool, opts GameOptions) *Game {
+	now := time.Now()
+	return &Game{
+		ID:          id,
+		Player1ID:   player1ID,
+		Player1Name: player1Name,
+		Player2ID:   player2ID,
+		Player2Name: player2Name,
+		Rows:        opts.Rows,
+		Columns:     opts.Columns,
+		WinLength:   opts.WinLength,
+		Variant:     opts.Variant,
+		TimeControl: opts.TimeControl,
+		Board:       NewBoard(opts.Rows, opts.Columns),
+		CurrentTurn: player1ID,
+		Status:      "active",
+		IsBot:       isBot,
+		Moves:       []Move{},
+		CreatedAt:   now,
+		UpdatedAt:   now,
+
+		Player1TimeMs: opts.TimeControl.StartingTime().Milliseconds(),
+		Player2TimeMs: opts.TimeControl.StartingTime().Milliseconds(),
+	}
+}
+
+// Clone returns a deep copy of the game that shares no mutable state with
+// the original.
+func (g *Game) Clone() *Game {
+	cp := *g
+	cp.Board = CopyBoard(g.Board)
+	cp.Moves = make([]Move, len(g.Moves))
+	copy(cp.Moves, g.Moves)
+	if g.WinningLines != nil {
+		cp.WinningLines = make([][]Cell, len(g.WinningLines))
+		for i, line := range g.WinningLines {
+			cp.WinningLines[i] = append([]Cell(nil), line...)
+		}
+	}
+	if g.WinningMove != nil {
+		m := *g.WinningMove
+		cp.WinningMove = &m
+	}
+	if g.Chat != nil {
+		cp.Chat = append([]ChatMessage(nil), g.Chat...)
+	}
+	if g.Series != nil {
+		cp.Series = g.Series.clone()
+	}
+	if g.HintsUsed != nil {
+		cp.HintsUsed = make(map[string]int, len(g.HintsUsed))
+		for k, v := range g.HintsUsed {
+			cp.HintsUsed[k] = v
+		}
+	}
+	if g.PositionCounts != nil {
+		cp.PositionCounts = make(map[uint64]int, len(g.PositionCounts))
+		for k, v := range g.PositionCounts {
+			cp.PositionCounts[k] = v
+		}
+	}
+	return &cp
+}
+
+// PlayerView returns the game as the players may see it, without the
+// spectators' chat. The game itself is not changed.
+func (g *Game) PlayerView() *Game {
+	hidden := false
+	for _, m := range g.Chat {
+		if m.Spectator {
+			hidden = true
+			break
+		}
+	}
+	if !hidden {
+		return g
+	}
+	cp := *g
+	cp.Chat = nil
+	for _, m := range g.Chat {
+		if !m.Spectator {
+			cp.Chat = append(cp.Chat, m)
+		}
+	}
+	return &cp
+}
+
+// Hinted reports whether either player used a hint, which keeps the game
+// out of rated play.
+func (g *Game) Hinted() bool {
+	return len(g.HintsUsed) > 0
+}
+
+// SeriesScore returns the score of the series the game is part of,
+// counting the game itself once it is over. It is nil for a game that is
+// neither a rematch nor rematched.
+func (g *Game) SeriesScore() *SeriesScore {
+	if g.Series == nil && g.RematchID == "" {
+		return nil
+	}
+	score := &SeriesScore{Wins: make(map[string]int)}
+	if g.Series != nil {
+		score = g.Series.clone()
+	}
+	if g.Status == "active" {
+		return score
+	}
+	score.Games++
+	if g.Winner != "" {
+		score.Wins[g.Winner]++
+	} else {
+		score.Draws++
+	}
+	return score
+}
+
+func (s *SeriesScore) clone() *SeriesScore {
+	cp := *s
+	cp.Wins = make(map[string]int, len(s.Wins))
+	for k, v := range s.Wins {
+		cp.Wins[k] = v
+	}
+	return &cp
+}
+
+// Rated reports whether the game counts for rated play: the players did
+// not choose an unrated game and no hints were used.
+func (g *Game) Rated() bool {
+	return !g.Unrated && !g.Hinted()
+}
+
+// Options returns the settings the game was created with.
+func (g *Game) Options() GameOptions {
+	return GameOptions{
+		Rows:      g.Rows,
+		Columns:   g.Columns,
+		WinLength: g.WinLength,
+		Variant:   g.Variant,
+
+		TimeControl: g.TimeControl,
+	}
 }
 
-//Move struct
+// Move is one accepted move of a game.
 type Move struct {
 	GameID    string    `json:"game_id"`
 	PlayerID  string    `json:"player_id"`
+	Ply       int       `json:"ply"` // 1 for the first move of the game
 	Column    int       `json:"column"`
+	Kind      string    `json:"kind"` // "drop" or "pop"
 	CreatedAt time.Time `json:"created_at"`
 }
 
@@ -1,21 +1,167 @@
 package models
 
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// Message is a frame sent by the server; frames from clients are read as
+// ClientMessage.
 type Message struct {
-	Type    string      `json:"type"` // "move", "join", "Leave", "game-state", "error"
+	// Type is one of "join", "rejoin", "move", "leave", "takeback-request",
+	// "takeback-accept", "takeback-decline", "resign", "draw-offer",
+	// "draw-accept", "draw-decline", "hint", "watch", "list-games", "chat",
+	// "create-room", "join-room", "cancel-room", "rematch-offer",
+	// "rematch-accept", "rematch-decline" from clients, and "hello",
+	// "game-state", "hint", "game-list", "chat", "room-created",
+	// "room-cancelled" or "error" from the server.
+	Type    string      `json:"type"`
 	GameID  string      `json:"game_id,omitempty"`
 	Payload interface{} `json:"payload,omitempty"`
 }
 
 type JoinPayload struct {
-	Username string `json:"username"`
+	Username   string `json:"username"`
+	Difficulty string `json:"difficulty,omitempty"` // used if matched with the bot
+	GameOptions
+}
+
+func (p *JoinPayload) Validate() error {
+	if p.Username == "" {
+		return errors.New("username is required")
+	}
+	return nil
+}
+
+// RejoinPayload resumes a game after a dropped connection, with the token
+// from the game-state sent on join.
+type RejoinPayload struct {
+	Token string `json:"token"`
+}
+
+func (p *RejoinPayload) Validate() error {
+	if p.Token == "" {
+		return errors.New("token is required")
+	}
+	return nil
 }
 
+// WatchPayload asks to spectate a game.
+type WatchPayload struct {
+	GameID   string `json:"game_id"`
+	Username string `json:"username,omitempty"` // shown in spectator chat
+}
+
+func (p *WatchPayload) Validate() error {
+	if p.GameID == "" {
+		return errors.New("game_id is required")
+	}
+	return nil
+}
+
+// ChatPayload sends a chat message to the game; the server answers with
+// a ChatMessage.
+type ChatPayload struct {
+	Text string `json:"text"`
+}
+
+func (p *ChatPayload) Validate() error {
+	if strings.TrimSpace(p.Text) == "" {
+		return errors.New("text is required")
+	}
+	return nil
+}
+
+// GameSummary describes a game in progress for the game list.
+type GameSummary struct {
+	ID          string    `json:"id"`
+	Player1Name string    `json:"player1_name"`
+	Player2Name string    `json:"player2_name"`
+	IsBot       bool      `json:"is_bot"`
+	Rows        int       `json:"rows"`
+	Columns     int       `json:"columns"`
+	WinLength   int       `json:"win_length"`
+	Variant     string    `json:"variant"`
+	Moves       int       `json:"moves"`
+	Spectators  int       `json:"spectators"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// NewGameSummary summarizes game for the game list.
+func NewGameSummary(game *Game, spectators int) GameSummary {
+	return GameSummary{
+		ID:          game.ID,
+		Player1Name: game.Player1Name,
+		Player2Name: game.Player2Name,
+		IsBot:       game.IsBot,
+		Rows:        game.Rows,
+		Columns:     game.Columns,
+		WinLength:   game.WinLength,
+		Variant:     game.Variant,
+		Moves:       len(game.Moves),
+		Spectators:  spectators,
+		CreatedAt:   game.CreatedAt,
+	}
+}
+
+type GameListPayload struct {
+	Games []GameSummary `json:"games"`
+}
+
+// Move kinds. A pop removes the mover's own disc from the bottom of a
+// column and is only legal in the PopOut variant.
+const (
+	MoveDrop = "drop"
+	MovePop  = "pop"
+)
+
 type MovePayload struct {
-	Column int `json:"column"`
+	Column int    `json:"column"`
+	Kind   string `json:"kind,omitempty"` // "drop" (default) or "pop"
+}
+
+// Position evaluations, for the player to move.
+const (
+	OutcomeWin     = "win"
+	OutcomeLoss    = "loss"
+	OutcomeDraw    = "draw"
+	OutcomeUnknown = "unknown" // the search could not prove a result in time
+)
+
+// HintPayload answers a hint request with a suggested move and an
+// evaluation of the position for the player who asked.
+type HintPayload struct {
+	Column    int     `json:"column"`
+	Kind      string  `json:"kind"`
+	Outcome   string  `json:"outcome"`
+	Plies     int     `json:"plies,omitempty"`    // moves until the result with best play
+	WinRate   float64 `json:"win_rate,omitempty"` // expected score when Outcome is unknown
+	HintsLeft int     `json:"hints_left"`
 }
 
 type GameStatePayload struct {
-	Game     *Game  `json:"game"`
-	PlayerID string `json:"player_id"`
-	Message  string `json:"message,omitempty"`
+	Game       *Game  `json:"game"`
+	PlayerID   string `json:"player_id"` // empty for spectators
+	Message    string `json:"message,omitempty"`
+	Clock      *Clock `json:"clock,omitempty"` // live clocks, nil for untimed games
+	Spectators int    `json:"spectators"`
+	// Series is the running score when the game is part of a series of
+	// rematches, counting this game once it is over.
+	Series *SeriesScore `json:"series,omitempty"`
+	// ResumeToken is only sent to the player it belongs to, on join and
+	// rejoin.
+	ResumeToken string `json:"resume_token,omitempty"`
+}
+
+// NewGameStatePayload builds the game-state payload for playerID, with the
+// clocks as of now.
+func NewGameStatePayload(game *Game, playerID, message string) GameStatePayload {
+	return GameStatePayload{
+		Game:     game,
+		PlayerID: playerID,
+		Message:  message,
+		Clock:    game.ClockAt(time.Now()),
+		Series:   game.SeriesScore(),
+	}
 }
@@ -9,8 +9,14 @@ type Player struct {
 	ELO      int    `json:"elo_rating"`
 }
 
+// PlayerStatus is a player's record over the games the server holds and
+// what they are doing now.
+type PlayerStatus struct {
+	Player
+	Waiting    bool   `json:"waiting"`               // in the matchmaking queue
+	ActiveGame string `json:"active_game,omitempty"` // game in progress, if any
+}
+
 type LeaderboardEntry struct {
 	Players []Player `json:"players"`
 }
-
-
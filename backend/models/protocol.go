@@ -0,0 +1,212 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// WebSocket protocol versions. Clients ask for a version with the
+// "connect4.v<N>" subprotocol when connecting; clients that ask for none get
+// MinProtocolVersion.
+const (
+	ProtocolVersion    = 1 // newest version the server speaks
+	MinProtocolVersion = 1 // oldest version still accepted
+
+	subprotocolPrefix = "connect4.v"
+)
+
+var (
+	ErrMalformedMessage   = errors.New("malformed message")
+	ErrUnknownMessageType = errors.New("unknown message type")
+	ErrInvalidPayload     = errors.New("invalid payload")
+)
+
+// Subprotocols lists the subprotocols of every supported version, newest
+// first, so that the newest one both sides speak is chosen.
+func Subprotocols() []string {
+	protocols := make([]string, 0, ProtocolVersion-MinProtocolVersion+1)
+	for v := ProtocolVersion; v >= MinProtocolVersion; v-- {
+		protocols = append(protocols, Subprotocol(v))
+	}
+	return protocols
+}
+
+// Subprotocol returns the subprotocol name of version v.
+func Subprotocol(v int) string {
+	return subprotocolPrefix + strconv.Itoa(v)
+}
+
+// ParseSubprotocol returns the version named by a subprotocol, and whether
+// it is one the server supports.
+func ParseSubprotocol(s string) (int, bool) {
+	if !strings.HasPrefix(s, subprotocolPrefix) {
+		return 0, false
+	}
+	v, err := strconv.Atoi(strings.TrimPrefix(s, subprotocolPrefix))
+	if err != nil || v < MinProtocolVersion || v > ProtocolVersion {
+		return 0, false
+	}
+	return v, true
+}
+
+// HelloPayload is sent once a connection is open, with the version it
+// negotiated.
+type HelloPayload struct {
+	Version    int    `json:"version"`
+	MinVersion int    `json:"min_version"`
+	MaxVersion int    `json:"max_version"`
+	Stream     string `json:"stream,omitempty"` // event streams only: where to POST messages
+}
+
+// clientPayloads maps every message type a client may send to a new value
+// of its payload type, or nil for messages without a payload.
+var clientPayloads = map[string]func() interface{}{
+	"join":             func() interface{} { return new(JoinPayload) },
+	"rejoin":           func() interface{} { return new(RejoinPayload) },
+	"move":             func() interface{} { return new(MovePayload) },
+	"watch":            func() interface{} { return new(WatchPayload) },
+	"chat":             func() interface{} { return new(ChatPayload) },
+	"create-room":      func() interface{} { return new(CreateRoomPayload) },
+	"join-room":        func() interface{} { return new(JoinRoomPayload) },
+	"cancel-room":      nil,
+	"leave":            nil,
+	"takeback-request": nil,
+	"takeback-accept":  nil,
+	"takeback-decline": nil,
+	"resign":           nil,
+	"draw-offer":       nil,
+	"draw-accept":      nil,
+	"draw-decline":     nil,
+	"rematch-offer":    nil,
+	"rematch-accept":   nil,
+	"rematch-decline":  nil,
+	"hint":             nil,
+	"list-games":       nil,
+}
+
+// ClientMessage is a frame received from a client. The payload is kept
+// raw until Decode checks it against the message type.
+type ClientMessage struct {
+	Type    string          `json:"type"`
+	GameID  string          `json:"game_id,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// ParseClientMessage decodes a frame and its payload. The payload is nil
+// for message types that carry none.
+func ParseClientMessage(data []byte) (ClientMessage, interface{}, error) {
+	var msg ClientMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return msg, nil, fmt.Errorf("%w: %v", ErrMalformedMessage, err)
+	}
+	payload, err := msg.Decode()
+	return msg, payload, err
+}
+
+// validator is implemented by payloads with required fields.
+type validator interface {
+	Validate() error
+}
+
+// Decode decodes the payload into the type registered for the message
+// type. Unknown fields and wrongly typed values are rejected.
+func (m ClientMessage) Decode() (interface{}, error) {
+	newPayload, ok := clientPayloads[m.Type]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownMessageType, m.Type)
+	}
+	if newPayload == nil {
+		return nil, nil
+	}
+	if len(m.Payload) == 0 || bytes.Equal(m.Payload, []byte("null")) {
+		return nil, fmt.Errorf("%w: %s needs a payload", ErrInvalidPayload, m.Type)
+	}
+
+	payload := newPayload()
+	if err := DecodePayload(m.Payload, payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// DecodePayload strictly decodes JSON into a payload struct and checks its
+// required fields. Errors wrap ErrInvalidPayload.
+func DecodePayload(data []byte, payload interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(payload); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+	}
+	if v, ok := payload.(validator); ok {
+		if err := v.Validate(); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+		}
+	}
+	return nil
+}
+
+// Error codes sent with every error message, and in REST API error
+// bodies, so that clients need not match on the text.
+const (
+	ErrCodeMalformedMessage   = "MALFORMED_MESSAGE"
+	ErrCodeUnknownMessageType = "UNKNOWN_MESSAGE_TYPE"
+	ErrCodeInvalidPayload     = "INVALID_PAYLOAD"
+	ErrCodeGameNotStarted     = "GAME_NOT_STARTED"
+	ErrCodeAlreadyPlaying     = "ALREADY_PLAYING"
+	ErrCodeSpectatorReadOnly  = "SPECTATOR_READ_ONLY"
+	ErrCodeUnauthorized       = "UNAUTHORIZED"
+	ErrCodePlayerNotFound     = "PLAYER_NOT_FOUND"
+	ErrCodeInvalidQuery       = "INVALID_QUERY"
+	ErrCodeStreamNotFound     = "STREAM_NOT_FOUND"
+	ErrCodeStreamBusy         = "STREAM_BUSY"
+
+	ErrCodeGameNotFound         = "GAME_NOT_FOUND"
+	ErrCodeGameNotActive        = "GAME_NOT_ACTIVE"
+	ErrCodeNotYourTurn          = "NOT_YOUR_TURN"
+	ErrCodeInvalidColumn        = "INVALID_COLUMN"
+	ErrCodeColumnFull           = "COLUMN_FULL"
+	ErrCodePopNotAllowed        = "POP_NOT_ALLOWED"
+	ErrCodeCannotPop            = "CANNOT_POP"
+	ErrCodeInvalidMoveKind      = "INVALID_MOVE_KIND"
+	ErrCodeTimeExpired          = "TIME_EXPIRED"
+	ErrCodeNotInGame            = "NOT_IN_GAME"
+	ErrCodeTakebackPending      = "TAKEBACK_PENDING"
+	ErrCodeNoTakebackRequest    = "NO_TAKEBACK_REQUEST"
+	ErrCodeNothingToTakeBack    = "NOTHING_TO_TAKE_BACK"
+	ErrCodeNotTakebackResponder = "NOT_TAKEBACK_RESPONDER"
+	ErrCodeDrawOfferPending     = "DRAW_OFFER_PENDING"
+	ErrCodeNoDrawOffer          = "NO_DRAW_OFFER"
+	ErrCodeNotDrawResponder     = "NOT_DRAW_RESPONDER"
+	ErrCodeNoHintsLeft          = "NO_HINTS_LEFT"
+	ErrCodeHintsUnavailable     = "HINTS_UNAVAILABLE"
+	ErrCodeHintFailed           = "HINT_FAILED"
+	ErrCodeInvalidResumeToken   = "INVALID_RESUME_TOKEN"
+	ErrCodeInvalidBoardSize     = "INVALID_BOARD_SIZE"
+	ErrCodeInvalidVariant       = "INVALID_VARIANT"
+	ErrCodeInvalidDifficulty    = "INVALID_DIFFICULTY"
+	ErrCodeInvalidTimeControl   = "INVALID_TIME_CONTROL"
+	ErrCodeChatTooLong          = "CHAT_TOO_LONG"
+	ErrCodeChatRateLimited      = "CHAT_RATE_LIMITED"
+	ErrCodeInvalidFirstMove     = "INVALID_FIRST_MOVE"
+	ErrCodeRoomNotFound         = "ROOM_NOT_FOUND"
+	ErrCodeRoomExpired          = "ROOM_EXPIRED"
+	ErrCodeNoOpenRoom           = "NO_OPEN_ROOM"
+	ErrCodeGameInProgress       = "GAME_IN_PROGRESS"
+	ErrCodeRematchPending       = "REMATCH_PENDING"
+	ErrCodeNoRematchOffer       = "NO_REMATCH_OFFER"
+	ErrCodeNotRematchResponder  = "NOT_REMATCH_RESPONDER"
+	ErrCodeRematchStarted       = "REMATCH_STARTED"
+	ErrCodeOpponentLeft         = "OPPONENT_LEFT"
+
+	ErrCodeInternal = "INTERNAL"
+)
+
+// ErrorPayload is the payload of an error message.
+type ErrorPayload struct {
+	Code  string `json:"code"`
+	Error string `json:"error"` // human-readable, may change between releases
+}
@@ -0,0 +1,86 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseClientMessage(t *testing.T) {
+	tests := []struct {
+		name, frame string
+		want        error
+	}{
+		{"move", `{"type":"move","payload":{"column":3}}`, nil},
+		{"pop", `{"type":"move","payload":{"column":3,"kind":"pop"}}`, nil},
+		{"no payload needed", `{"type":"resign"}`, nil},
+		{"join with options", `{"type":"join","payload":{"username":"a","rows":7,"columns":8}}`, nil},
+		{"not JSON", `{"type":`, ErrMalformedMessage},
+		{"unknown type", `{"type":"teleport"}`, ErrUnknownMessageType},
+		{"missing payload", `{"type":"move"}`, ErrInvalidPayload},
+		{"null payload", `{"type":"move","payload":null}`, ErrInvalidPayload},
+		{"unknown field", `{"type":"move","payload":{"column":3,"row":2}}`, ErrInvalidPayload},
+		{"unknown embedded field", `{"type":"join","payload":{"username":"a","rowz":7}}`, ErrInvalidPayload},
+		{"wrong type", `{"type":"move","payload":{"column":"3"}}`, ErrInvalidPayload},
+		{"payload not an object", `{"type":"move","payload":[3]}`, ErrInvalidPayload},
+		{"required field missing", `{"type":"join","payload":{}}`, ErrInvalidPayload},
+		{"blank chat", `{"type":"chat","payload":{"text":"  "}}`, ErrInvalidPayload},
+	}
+	for _, tt := range tests {
+		_, _, err := ParseClientMessage([]byte(tt.frame))
+		if tt.want == nil && err != nil || !errors.Is(err, tt.want) {
+			t.Errorf("%s: %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestParseClientMessagePayloadTypes(t *testing.T) {
+	_, payload, err := ParseClientMessage([]byte(`{"type":"move","payload":{"column":3,"kind":"pop"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	move, ok := payload.(*MovePayload)
+	if !ok || move.Column != 3 || move.Kind != MovePop {
+		t.Errorf("payload = %#v", payload)
+	}
+
+	_, payload, err = ParseClientMessage([]byte(`{"type":"hint"}`))
+	if err != nil || payload != nil {
+		t.Errorf("hint: payload %#v, error %v", payload, err)
+	}
+}
+
+func TestDecodePayloadUnknownFields(t *testing.T) {
+	var move MovePayload
+	if err := DecodePayload([]byte(`{"column":1,"colum":2}`), &move); !errors.Is(err, ErrInvalidPayload) {
+		t.Errorf("DecodePayload: %v, want ErrInvalidPayload", err)
+	}
+	if err := DecodePayload([]byte(`{"column":1}`), &move); err != nil || move.Column != 1 {
+		t.Errorf("DecodePayload: %v, column %d", err, move.Column)
+	}
+}
+
+func TestParseSubprotocol(t *testing.T) {
+	tests := []struct {
+		protocol string
+		version  int
+		ok       bool
+	}{
+		{Subprotocol(ProtocolVersion), ProtocolVersion, true},
+		{Subprotocol(MinProtocolVersion), MinProtocolVersion, true},
+		{Subprotocol(ProtocolVersion + 1), 0, false},
+		{Subprotocol(MinProtocolVersion - 1), 0, false},
+		{"connect4.vx", 0, false},
+		{"connect4.v", 0, false},
+		{"chat", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		v, ok := ParseSubprotocol(tt.protocol)
+		if v != tt.version || ok != tt.ok {
+			t.Errorf("ParseSubprotocol(%q) = %d, %v; want %d, %v", tt.protocol, v, ok, tt.version, tt.ok)
+		}
+	}
+	if p := Subprotocols(); len(p) == 0 || p[0] != Subprotocol(ProtocolVersion) {
+		t.Errorf("Subprotocols() = %v, want the newest version first", p)
+	}
+}
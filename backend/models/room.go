@@ -0,0 +1,79 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// Who moves first in a private room's game.
+const (
+	FirstMoveHost   = "host" // the player who created the room
+	FirstMoveGuest  = "guest"
+	FirstMoveRandom = "random"
+)
+
+var ErrInvalidFirstMove = errors.New("invalid first move")
+
+// RoomOptions are the settings of a private room: the game options, plus
+// whether the game is rated and who moves first.
+type RoomOptions struct {
+	GameOptions
+	Unrated   bool   `json:"unrated,omitempty"`
+	FirstMove string `json:"first_move,omitempty"` // "host" (default), "guest" or "random"
+}
+
+// Normalize fills unset fields with the defaults and validates the result.
+func (o RoomOptions) Normalize() (RoomOptions, error) {
+	opts, err := o.GameOptions.Normalize()
+	if err != nil {
+		return o, err
+	}
+	o.GameOptions = opts
+	if o.FirstMove == "" {
+		o.FirstMove = FirstMoveHost
+	}
+	switch o.FirstMove {
+	case FirstMoveHost, FirstMoveGuest, FirstMoveRandom:
+		return o, nil
+	}
+	return o, ErrInvalidFirstMove
+}
+
+// CreateRoomPayload opens a private room. The server answers with a
+// RoomPayload and starts the game when someone joins with its code.
+type CreateRoomPayload struct {
+	Username string `json:"username"`
+	RoomOptions
+}
+
+func (p *CreateRoomPayload) Validate() error {
+	if p.Username == "" {
+		return errors.New("username is required")
+	}
+	return nil
+}
+
+// JoinRoomPayload joins the private room with the given code.
+type JoinRoomPayload struct {
+	Username string `json:"username"`
+	Code     string `json:"code"`
+}
+
+func (p *JoinRoomPayload) Validate() error {
+	if p.Username == "" {
+		return errors.New("username is required")
+	}
+	if strings.TrimSpace(p.Code) == "" {
+		return errors.New("code is required")
+	}
+	return nil
+}
+
+// RoomPayload tells the host the code to share with their opponent, and
+// confirms a cancelled room.
+type RoomPayload struct {
+	Code      string      `json:"code"`
+	Options   RoomOptions `json:"options"`
+	ExpiresAt time.Time   `json:"expires_at"`
+}
@@ -0,0 +1,72 @@
+package notation
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"4-in-a-row/models"
+)
+
+// Column-sequence notation writes a game as the 1-based columns played,
+// e.g. "4453627". Columns past 9 use letters ("a" is column 10) and a pop
+// move in PopOut is the column prefixed with "p", e.g. "44p4".
+const columnDigits = "123456789abcdef"
+
+const popPrefix = 'p'
+
+var ErrInvalidNotation = errors.New("invalid move notation")
+
+// FormatMoves writes moves in column-sequence notation.
+func FormatMoves(moves []models.Move) string {
+	var sb strings.Builder
+	for _, m := range moves {
+		if m.Kind == models.MovePop {
+			sb.WriteByte(popPrefix)
+		}
+		sb.WriteByte(columnDigits[m.Column])
+	}
+	return sb.String()
+}
+
+// ParseMoves reads column-sequence notation for a board with the given
+// number of columns. Whitespace is ignored. Only the notation itself is
+// checked here; the moves' legality is checked when they are replayed.
+func ParseMoves(s string, columns int) ([]models.MovePayload, error) {
+	var moves []models.MovePayload
+	pop := false
+	for i, r := range strings.ToLower(s) {
+		switch {
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			if pop {
+				return nil, fmt.Errorf("%w: dangling %q at offset %d", ErrInvalidNotation, popPrefix, i)
+			}
+			continue
+		case r == popPrefix && !pop:
+			pop = true
+			continue
+		}
+		col := strings.IndexRune(columnDigits, r)
+		if col < 0 || col >= columns {
+			return nil, fmt.Errorf("%w: unexpected %q at offset %d", ErrInvalidNotation, r, i)
+		}
+		kind := models.MoveDrop
+		if pop {
+			kind = models.MovePop
+		}
+		moves = append(moves, models.MovePayload{Column: col, Kind: kind})
+		pop = false
+	}
+	if pop {
+		return nil, fmt.Errorf("%w: dangling %q at end", ErrInvalidNotation, popPrefix)
+	}
+	return moves, nil
+}
+
+// formatMove writes a single move.
+func formatMove(m models.MovePayload) string {
+	if m.Kind == models.MovePop {
+		return string(popPrefix) + string(columnDigits[m.Column])
+	}
+	return string(columnDigits[m.Column])
+}
@@ -0,0 +1,92 @@
+package notation
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"4-in-a-row/models"
+)
+
+func TestMovesRoundTrip(t *testing.T) {
+	tests := []struct {
+		text    string
+		columns int
+		moves   []models.MovePayload
+	}{
+		{"", 7, nil},
+		{"4453627", 7, []models.MovePayload{
+			{Column: 3, Kind: models.MoveDrop}, {Column: 3, Kind: models.MoveDrop},
+			{Column: 4, Kind: models.MoveDrop}, {Column: 2, Kind: models.MoveDrop},
+			{Column: 5, Kind: models.MoveDrop}, {Column: 1, Kind: models.MoveDrop},
+			{Column: 6, Kind: models.MoveDrop},
+		}},
+		{"44p4", 7, []models.MovePayload{
+			{Column: 3, Kind: models.MoveDrop}, {Column: 3, Kind: models.MoveDrop},
+			{Column: 3, Kind: models.MovePop},
+		}},
+		{"9ap1f", 15, []models.MovePayload{
+			{Column: 8, Kind: models.MoveDrop}, {Column: 9, Kind: models.MoveDrop},
+			{Column: 0, Kind: models.MovePop}, {Column: 14, Kind: models.MoveDrop},
+		}},
+	}
+	for _, tt := range tests {
+		moves, err := ParseMoves(tt.text, tt.columns)
+		if err != nil {
+			t.Errorf("ParseMoves(%q): %v", tt.text, err)
+			continue
+		}
+		if !reflect.DeepEqual(moves, tt.moves) {
+			t.Errorf("ParseMoves(%q) = %v, want %v", tt.text, moves, tt.moves)
+		}
+
+		played := make([]models.Move, len(moves))
+		for i, m := range moves {
+			played[i] = models.Move{Ply: i + 1, Column: m.Column, Kind: m.Kind}
+		}
+		if got := FormatMoves(played); got != tt.text {
+			t.Errorf("FormatMoves(ParseMoves(%q)) = %q", tt.text, got)
+		}
+	}
+}
+
+func TestParseMovesLenient(t *testing.T) {
+	moves, err := ParseMoves(" 44 P4\n\t53\r\n", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := formatPayloads(moves); got != "44p453" {
+		t.Errorf("got %q, want %q", got, "44p453")
+	}
+}
+
+func TestParseMovesInvalid(t *testing.T) {
+	tests := []struct {
+		text    string
+		columns int
+	}{
+		{"48", 7},  // past the last column
+		{"0", 7},   // columns are 1-based
+		{"4x", 7},  // not a column
+		{"a", 9},   // letters only on wide boards
+		{"4p", 7},  // pop without a column
+		{"p 4", 7}, // pop split from its column
+		{"pp4", 7}, // doubled prefix
+		{"4-5", 7}, // separators other than whitespace
+		{"4é4", 7}, // non-ASCII
+	}
+	for _, tt := range tests {
+		if moves, err := ParseMoves(tt.text, tt.columns); !errors.Is(err, ErrInvalidNotation) {
+			t.Errorf("ParseMoves(%q, %d) = %v, %v; want ErrInvalidNotation", tt.text, tt.columns, moves, err)
+		}
+	}
+}
+
+// formatPayloads is FormatMoves for parsed moves.
+func formatPayloads(moves []models.MovePayload) string {
+	s := ""
+	for _, m := range moves {
+		s += formatMove(m)
+	}
+	return s
+}
@@ -0,0 +1,322 @@
+package notation
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"4-in-a-row/models"
+)
+
+// Results, as in chess PGN.
+const (
+	ResultPlayer1 = "1-0"
+	ResultPlayer2 = "0-1"
+	ResultDraw    = "1/2-1/2"
+	ResultOngoing = "*"
+)
+
+// Terminations record how a finished game ended.
+const (
+	TerminationNormal       = "normal" // a line was completed or the board filled
+	TerminationResignation  = "resignation"
+	TerminationAgreement    = "agreement"
+	TerminationTimeForfeit  = "time forfeit"
+	TerminationAbandoned    = "abandoned"
+	TerminationUnterminated = "unterminated"
+)
+
+const dateLayout = "2006.01.02"
+
+// Record is a game in the PGN-like text format:
+//
+//	[Event "Connect Four"]
+//	[Date "2026.10.18"]
+//	[Player1 "alice"]
+//	[Player2 "bob"]
+//	[Result "1-0"]
+//	[Termination "normal"]
+//	[Variant "standard"]
+//	[Rows "6"]
+//	[Columns "7"]
+//	[WinLength "4"]
+//
+//	1. 4 4 2. 5 3 3. 6 7 4. 3 1-0
+//
+// Board and variant tags may be omitted for a standard game.
+type Record struct {
+	Event       string
+	Date        time.Time
+	Player1     string
+	Player2     string
+	Result      string
+	Termination string
+	Options     models.GameOptions
+	Moves       []models.MovePayload
+}
+
+// FromGame builds a record of game.
+func FromGame(game *models.Game) *Record {
+	r := &Record{
+		Event:       "Connect Four",
+		Date:        game.CreatedAt,
+		Player1:     game.Player1Name,
+		Player2:     game.Player2Name,
+		Result:      ResultOf(game),
+		Termination: TerminationOf(game.Status),
+		Options:     game.Options(),
+	}
+	for _, m := range game.Moves {
+		r.Moves = append(r.Moves, models.MovePayload{Column: m.Column, Kind: m.Kind})
+	}
+	return r
+}
+
+// ResultOf returns the result tag for game.
+func ResultOf(game *models.Game) string {
+	switch {
+	case game.Status == "active":
+		return ResultOngoing
+	case game.Winner == game.Player1ID:
+		return ResultPlayer1
+	case game.Winner == game.Player2ID:
+		return ResultPlayer2
+	}
+	return ResultDraw
+}
+
+// TerminationOf maps a game status to its termination tag.
+func TerminationOf(status string) string {
+	switch status {
+	case "active":
+		return TerminationUnterminated
+	case "resigned":
+		return TerminationResignation
+	case "agreed-draw":
+		return TerminationAgreement
+	case "timeout":
+		return TerminationTimeForfeit
+	case "abandoned":
+		return TerminationAbandoned
+	}
+	return TerminationNormal
+}
+
+// StatusOf maps a termination tag back to a game status. Normal
+// terminations return "" because the status follows from the moves.
+func StatusOf(termination string) string {
+	switch termination {
+	case TerminationResignation:
+		return "resigned"
+	case TerminationAgreement:
+		return "agreed-draw"
+	case TerminationTimeForfeit:
+		return "timeout"
+	case TerminationAbandoned:
+		return "abandoned"
+	}
+	return ""
+}
+
+// String writes the record in the PGN-like format.
+func (r *Record) String() string {
+	var sb strings.Builder
+	tag := func(name, value string) {
+		fmt.Fprintf(&sb, "[%s %q]\n", name, value)
+	}
+	tag("Event", r.Event)
+	if !r.Date.IsZero() {
+		tag("Date", r.Date.Format(dateLayout))
+	}
+	tag("Player1", r.Player1)
+	tag("Player2", r.Player2)
+	tag("Result", r.result())
+	if r.Termination != "" {
+		tag("Termination", r.Termination)
+	}
+	opts := r.Options
+	if opts.Variant != "" {
+		tag("Variant", opts.Variant)
+	}
+	if opts.Rows != 0 {
+		tag("Rows", strconv.Itoa(opts.Rows))
+	}
+	if opts.Columns != 0 {
+		tag("Columns", strconv.Itoa(opts.Columns))
+	}
+	if opts.WinLength != 0 {
+		tag("WinLength", strconv.Itoa(opts.WinLength))
+	}
+	sb.WriteByte('\n')
+
+	for i, m := range r.Moves {
+		if i%2 == 0 {
+			fmt.Fprintf(&sb, "%d. ", i/2+1)
+		}
+		sb.WriteString(formatMove(m))
+		sb.WriteByte(' ')
+	}
+	sb.WriteString(r.result())
+	sb.WriteByte('\n')
+	return sb.String()
+}
+
+func (r *Record) result() string {
+	if r.Result == "" {
+		return ResultOngoing
+	}
+	return r.Result
+}
+
+// ParsePGN reads a record in the PGN-like format. Unknown tags are
+// ignored. The board options are normalized, so missing tags mean the
+// standard game.
+func ParsePGN(text string) (*Record, error) {
+	r := &Record{}
+	var movetext []string
+
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for line := 1; scanner.Scan(); line++ {
+		s := strings.TrimSpace(scanner.Text())
+		if s == "" {
+			continue
+		}
+		if !strings.HasPrefix(s, "[") {
+			movetext = append(movetext, s)
+			continue
+		}
+		name, value, err := parseTag(s)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if err := r.setTag(name, value); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	opts, err := r.Options.Normalize()
+	if err != nil {
+		return nil, err
+	}
+	r.Options = opts
+
+	for _, tok := range strings.Fields(strings.Join(movetext, " ")) {
+		switch {
+		case tok == ResultPlayer1 || tok == ResultPlayer2 || tok == ResultDraw || tok == ResultOngoing:
+			if r.Result != "" && r.Result != tok {
+				return nil, fmt.Errorf("%w: result %q contradicts tag %q", ErrInvalidNotation, tok, r.Result)
+			}
+			r.Result = tok
+			continue
+		case strings.HasSuffix(tok, "."):
+			if _, err := strconv.Atoi(strings.TrimSuffix(tok, ".")); err != nil {
+				return nil, fmt.Errorf("%w: bad move number %q", ErrInvalidNotation, tok)
+			}
+			continue
+		}
+		moves, err := ParseMoves(tok, opts.Columns)
+		if err != nil {
+			return nil, err
+		}
+		if len(moves) != 1 {
+			return nil, fmt.Errorf("%w: expected one move, got %q", ErrInvalidNotation, tok)
+		}
+		r.Moves = append(r.Moves, moves[0])
+	}
+	if r.Result == "" {
+		r.Result = ResultOngoing
+	}
+	return r, nil
+}
+
+func parseTag(s string) (name, value string, err error) {
+	if !strings.HasSuffix(s, "]") {
+		return "", "", fmt.Errorf("%w: unterminated tag %q", ErrInvalidNotation, s)
+	}
+	name, quoted, ok := strings.Cut(strings.TrimSpace(s[1:len(s)-1]), " ")
+	if !ok {
+		return "", "", fmt.Errorf("%w: tag without value %q", ErrInvalidNotation, s)
+	}
+	value, err = strconv.Unquote(strings.TrimSpace(quoted))
+	if err != nil {
+		return "", "", fmt.Errorf("%w: bad tag value %q", ErrInvalidNotation, s)
+	}
+	return name, value, nil
+}
+
+func (r *Record) setTag(name, value string) error {
+	var err error
+	switch name {
+	case "Event":
+		r.Event = value
+	case "Date":
+		r.Date, err = time.Parse(dateLayout, value)
+	case "Player1":
+		r.Player1 = value
+	case "Player2":
+		r.Player2 = value
+	case "Result":
+		if value != ResultPlayer1 && value != ResultPlayer2 && value != ResultDraw && value != ResultOngoing {
+			return fmt.Errorf("%w: bad Result tag %q", ErrInvalidNotation, value)
+		}
+		r.Result = value
+	case "Termination":
+		r.Termination = value
+	case "Variant":
+		r.Options.Variant = value
+	case "Rows":
+		r.Options.Rows, err = strconv.Atoi(value)
+	case "Columns":
+		r.Options.Columns, err = strconv.Atoi(value)
+	case "WinLength":
+		r.Options.WinLength, err = strconv.Atoi(value)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: bad %s tag %q", ErrInvalidNotation, name, value)
+	}
+	return nil
+}
+
+// ParsePGNs reads a file of records such as the tournament command
+// writes. A record ends where the tag section of the next one begins.
+func ParsePGNs(text string) ([]*Record, error) {
+	var records []*Record
+	var chunk []string
+	inMoves := false
+	flush := func() error {
+		if len(chunk) == 0 {
+			return nil
+		}
+		r, err := ParsePGN(strings.Join(chunk, "\n"))
+		if err != nil {
+			return fmt.Errorf("record %d: %w", len(records)+1, err)
+		}
+		records = append(records, r)
+		chunk, inMoves = nil, false
+		return nil
+	}
+	for _, line := range strings.Split(text, "\n") {
+		s := strings.TrimSpace(line)
+		if s == "" {
+			continue
+		}
+		if strings.HasPrefix(s, "[") && inMoves {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		}
+		if !strings.HasPrefix(s, "[") {
+			inMoves = true
+		}
+		chunk = append(chunk, s)
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
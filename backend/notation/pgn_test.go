@@ -0,0 +1,128 @@
+package notation
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"4-in-a-row/models"
+)
+
+func popOutRecord() *Record {
+	opts, _ := models.GameOptions{Variant: models.VariantPopOut, Rows: 5, Columns: 6}.Normalize()
+	moves, _ := ParseMoves("3344p34p4", opts.Columns)
+	return &Record{
+		Event:       "Club night",
+		Date:        time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC),
+		Player1:     "alice",
+		Player2:     "bob \"the builder\"",
+		Result:      ResultPlayer2,
+		Termination: TerminationResignation,
+		Options:     opts,
+		Moves:       moves,
+	}
+}
+
+func TestPGNRoundTrip(t *testing.T) {
+	standard, _ := models.GameOptions{}.Normalize()
+	records := []*Record{
+		popOutRecord(),
+		{
+			Event:       "Connect Four",
+			Player1:     "carol",
+			Player2:     "dave",
+			Result:      ResultOngoing,
+			Termination: TerminationUnterminated,
+			Options:     standard,
+			Moves:       []models.MovePayload{{Column: 3, Kind: models.MoveDrop}},
+		},
+	}
+	for _, want := range records {
+		text := want.String()
+		got, err := ParsePGN(text)
+		if err != nil {
+			t.Fatalf("ParsePGN(%q): %v", text, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("ParsePGN(String()) = %+v, want %+v", got, want)
+		}
+	}
+
+	var all strings.Builder
+	for _, r := range records {
+		all.WriteString(r.String())
+		all.WriteString("\n")
+	}
+	got, err := ParsePGNs(all.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, records) {
+		t.Errorf("ParsePGNs = %+v, want %+v", got, records)
+	}
+}
+
+func TestPGNFormat(t *testing.T) {
+	text := popOutRecord().String()
+	for _, want := range []string{
+		`[Player2 "bob \"the builder\""]`,
+		`[Date "2026.10.18"]`,
+		`[Variant "popout"]`,
+		"1. 3 3 2. 4 4 3. p3 4 4. p4 0-1",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("record lacks %q:\n%s", want, text)
+		}
+	}
+}
+
+// TestParsePGNDefaults checks that a bare move list is a standard game in
+// progress.
+func TestParsePGNDefaults(t *testing.T) {
+	r, err := ParsePGN("1. 4 4 2. 5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Result != ResultOngoing || r.Options != models.DefaultGameOptions() || len(r.Moves) != 3 {
+		t.Errorf("got %+v", r)
+	}
+}
+
+func TestParsePGNInvalid(t *testing.T) {
+	tests := []struct {
+		name, text string
+		notation   bool // whether the error is ErrInvalidNotation
+	}{
+		{"unterminated tag", `[Event "x"`, true},
+		{"tag without value", "[Event]", true},
+		{"unquoted tag value", "[Event x]", true},
+		{"bad result tag", `[Result "2-0"]`, true},
+		{"bad date", `[Date "18/10/2026"]`, true},
+		{"bad rows tag", `[Rows "six"]`, true},
+		{"result contradicts tag", "[Result \"1-0\"]\n\n1. 4 4 0-1", true},
+		{"bad move number", "x. 4 4", true},
+		{"two moves in one token", "1. 44", true},
+		{"column out of range", "[Columns \"5\"]\n\n1. 6", true},
+		{"unsupported board", `[Rows "40"]`, false},
+	}
+	for _, tt := range tests {
+		_, err := ParsePGN(tt.text)
+		if err == nil {
+			t.Errorf("%s: no error", tt.name)
+			continue
+		}
+		if tt.notation && !errors.Is(err, ErrInvalidNotation) {
+			t.Errorf("%s: %v, want ErrInvalidNotation", tt.name, err)
+		}
+	}
+}
+
+func TestParsePGNsInvalid(t *testing.T) {
+	text := popOutRecord().String() + "\n[Event \"broken\"]\n\n1. 9 *\n"
+	_, err := ParsePGNs(text)
+	if !errors.Is(err, ErrInvalidNotation) || !strings.Contains(err.Error(), "record 2") {
+		t.Errorf("ParsePGNs: %v, want an error in record 2", err)
+	}
+}
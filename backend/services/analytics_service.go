@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"4-in-a-row/kafka"
+	"4-in-a-row/models"
 )
 
 type AnalyticsService struct {
@@ -14,38 +15,56 @@ func NewAnalyticsService(producer *kafka.KafkaProducer) *AnalyticsService {
 	return &AnalyticsService{producer: producer}
 }
 
-func (as *AnalyticsService) LogMove(gameID, playerID string, column int) {
+func (as *AnalyticsService) LogMove(game *models.Game, playerID string, move models.MovePayload) {
 	if as.producer == nil {
 		return
 	}
+	data := map[string]interface{}{
+		"column": move.Column,
+		"kind":   move.Kind,
+	}
+	addBotData(data, game)
 	event := kafka.GameEvent{
 		EventType: "move",
-		GameID:    gameID,
+		GameID:    game.ID,
 		PlayerID:  playerID,
 		Timestamp: time.Now().Unix(),
-		Data: map[string]interface{}{
-			"column": column,
-		},
+		Data:      data,
 	}
 	as.producer.SendEventAsync(event)
 }
 
-func (as *AnalyticsService) LogGameEnd(gameID, winnerID, status string) {
+func (as *AnalyticsService) LogGameEnd(game *models.Game) {
 	if as.producer == nil {
 		return
 	}
+	data := map[string]interface{}{
+		"winner": game.Winner,
+		"status": game.Status,
+		"hinted": game.Hinted(),
+		"rated":  game.Rated(),
+	}
+	if game.WinningMove != nil {
+		data["winning_lines"] = game.WinningLines
+		data["winning_ply"] = game.WinningMove.Ply
+	}
+	addBotData(data, game)
 	event := kafka.GameEvent{
 		EventType: "game_end",
-		GameID:    gameID,
+		GameID:    game.ID,
 		Timestamp: time.Now().Unix(),
-		Data: map[string]interface{}{
-			"winner": winnerID,
-			"status": status,
-		},
+		Data:      data,
 	}
 	as.producer.SendEventAsync(event)
 }
 
+// addBotData tags events from bot games with the bot's difficulty.
+func addBotData(data map[string]interface{}, game *models.Game) {
+	if game.IsBot {
+		data["difficulty"] = game.Difficulty
+	}
+}
+
 func (as *AnalyticsService) LogGameAbandoned(gameID, playerID string) {
 	if as.producer == nil {
 		return
@@ -0,0 +1,28 @@
+package services
+
+import (
+	"4-in-a-row/models"
+	"errors"
+)
+
+var (
+	ErrHintsUnavailable = errors.New("hints are not available")
+	ErrHintFailed       = errors.New("could not compute a hint")
+)
+
+// Bot is a computer player. GameHandler only talks to this interface, so
+// any strategy can be plugged in without touching it.
+type Bot interface {
+	// Name identifies the bot in logs.
+	Name() string
+	// MakeBotMove picks a move for the player whose turn it is, which may
+	// be either player: colors swap in a rematch. Column is -1 when there
+	// is no legal move.
+	MakeBotMove(game *models.Game) models.MovePayload
+}
+
+// Hinter is a bot that can suggest a move to a human player and evaluate
+// the position for them.
+type Hinter interface {
+	Hint(game *models.Game) (models.HintPayload, error)
+}
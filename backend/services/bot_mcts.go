@@ -0,0 +1,109 @@
+package services
+
+import (
+	"4-in-a-row/engine"
+	"4-in-a-row/mcts"
+	"4-in-a-row/models"
+	"log"
+	"reflect"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// mctsTreeTTL is how long an idle game's search tree is kept. Trees are
+// dropped when their game ends; this only catches trees that outlive it,
+// such as one built for a move that raced the game's end.
+const mctsTreeTTL = 15 * time.Minute
+
+// mctsTree is a game's MCTS searcher, kept between the bot's moves so the
+// subtree below the moves actually played is searched further instead of
+// being rebuilt.
+type mctsTree struct {
+	mu       sync.Mutex
+	searcher *mcts.Searcher
+	moves    []models.Move // moves leading to the searcher's root
+	used     time.Time     // guarded by BotService.treesMu
+}
+
+// mctsMove searches the game's position for the configured think time.
+// ok is false if no move could be found.
+func (bs *BotService) mctsMove(game *models.Game) (move models.MovePayload, ok bool) {
+	tree := bs.treeFor(game.ID)
+	tree.mu.Lock()
+	defer tree.mu.Unlock()
+
+	if !tree.catchUp(game) {
+		pos, err := engine.FromBoard(game.Board, game.WinLength, pieceFor(game, game.CurrentTurn))
+		if err != nil {
+			return move, false
+		}
+		popout := game.Variant == models.VariantPopOut
+		tree.searcher = mcts.New(pos, popout, runtime.GOMAXPROCS(0))
+		tree.moves = append([]models.Move(nil), game.Moves...)
+	}
+
+	r, err := tree.searcher.Search(bs.thinkTime)
+	if err != nil {
+		log.Printf("MCTS search for game %s: %v\n", game.ID, err)
+		return move, false
+	}
+
+	move = models.MovePayload{Column: r.Move.Column, Kind: models.MoveDrop}
+	if r.Move.Pop {
+		move.Kind = models.MovePop
+	}
+	tree.searcher.Advance(r.Move)
+	tree.moves = append(tree.moves, models.Move{Column: move.Column, Kind: move.Kind})
+	return move, true
+}
+
+// treeFor returns the game's tree, creating it if needed, and drops trees
+// of games that have gone idle.
+func (bs *BotService) treeFor(gameID string) *mctsTree {
+	bs.treesMu.Lock()
+	defer bs.treesMu.Unlock()
+	now := time.Now()
+	for id, t := range bs.trees {
+		if now.Sub(t.used) > mctsTreeTTL {
+			delete(bs.trees, id)
+		}
+	}
+	tree := bs.trees[gameID]
+	if tree == nil {
+		tree = &mctsTree{}
+		bs.trees[gameID] = tree
+	}
+	tree.used = now
+	return tree
+}
+
+// dropTree drops the game's tree, if any. A search still running on it
+// finishes unaffected.
+func (bs *BotService) dropTree(gameID string) {
+	bs.treesMu.Lock()
+	delete(bs.trees, gameID)
+	bs.treesMu.Unlock()
+}
+
+// catchUp advances the searcher over the moves played since it last
+// searched. It returns false when the tree can't be reused, e.g. after a
+// takeback.
+func (t *mctsTree) catchUp(game *models.Game) bool {
+	if t.searcher == nil || len(game.Moves) < len(t.moves) {
+		return false
+	}
+	for i, m := range t.moves {
+		if game.Moves[i].Column != m.Column || game.Moves[i].Kind != m.Kind {
+			return false
+		}
+	}
+	for _, m := range game.Moves[len(t.moves):] {
+		if !t.searcher.Advance(mcts.Move{Column: m.Column, Pop: m.Kind == models.MovePop}) {
+			return false
+		}
+		t.moves = append(t.moves, m)
+	}
+	pos := t.searcher.Position()
+	return reflect.DeepEqual(pos.Board(), game.Board)
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"4-in-a-row/models"
+	"testing"
+	"time"
+)
+
+// TestTreesDroppedWithGames checks that a game's MCTS tree goes away as
+// soon as the game ends or is deleted, without waiting for the TTL.
+func TestTreesDroppedWithGames(t *testing.T) {
+	gs := NewGameService()
+	bs := NewBotService(gs, 10*time.Millisecond)
+	trees := func() int {
+		bs.treesMu.Lock()
+		defer bs.treesMu.Unlock()
+		return len(bs.trees)
+	}
+
+	newGame := func(id string) *models.Game {
+		game := models.NewGame(id, "a", "a", "bot", "bot", true, models.DefaultGameOptions())
+		game.Difficulty = models.DifficultyMCTS
+		game, err := gs.StoreGame(game)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if game, err = gs.PlayMove(id, "a", models.MovePayload{Column: 3}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := gs.PlayMove(id, "bot", bs.MakeBotMove(game)); err != nil {
+			t.Fatal(err)
+		}
+		return game
+	}
+
+	newGame("resigned")
+	newGame("deleted")
+	if n := trees(); n != 2 {
+		t.Fatalf("%d trees after two bot moves, want 2", n)
+	}
+
+	if _, err := gs.Resign("resigned", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if n := trees(); n != 1 {
+		t.Errorf("%d trees after a resignation, want 1", n)
+	}
+	gs.DeleteGame("deleted")
+	if n := trees(); n != 0 {
+		t.Errorf("%d trees after deleting the game, want 0", n)
+	}
+
+	// A second bot on the same games keeps its own trees, dropped alike
+	// when a game is won. The player stacks four in column 0 while the
+	// bot plays columns 5 and 6, never more than three in either.
+	other := NewBotService(gs, 10*time.Millisecond)
+	game := newGame("won")
+	other.MakeBotMove(game)
+	for _, col := range []int{5, 6, 5} {
+		if _, err := gs.PlayMove("won", "a", models.MovePayload{Column: 0}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := gs.PlayMove("won", "bot", models.MovePayload{Column: col}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(other.trees); n != 1 {
+		t.Fatalf("second bot holds %d trees, want 1", n)
+	}
+	game, err := gs.PlayMove("won", "a", models.MovePayload{Column: 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if game.Status != "won" {
+		t.Fatalf("game %s, want it won", game.Status)
+	}
+	if n := trees() + len(other.trees); n != 0 {
+		t.Errorf("%d trees after the game was won, want 0", n)
+	}
+}
@@ -1,73 +1,296 @@
 package services
 
 import (
+	"4-in-a-row/book"
+	"4-in-a-row/engine"
+	"4-in-a-row/mcts"
 	"4-in-a-row/models"
+	"4-in-a-row/solver"
+	"errors"
+	"math/rand"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Search settings per difficulty. Easy plays the heuristic but blunders
+// into a random column every so often; perfect falls back to the hard
+// search if the position can't be solved in time.
+const (
+	easyBlunderRate = 0.35
+	mediumDepth     = 4
+	mediumThinkTime = 200 * time.Millisecond
+	hardDepth       = 12
+	hardThinkTime   = time.Second
+	perfectTimeout  = 4 * time.Second
+	hintThinkTime   = 2 * time.Second
 )
 
 type BotService struct {
 	gameservice *GameService
+	thinkTime   time.Duration // MCTS budget per move
+	trees       map[string]*mctsTree
+	treesMu     sync.Mutex
+	book        *book.Book
+	bookPlies   int
+
+	// solvers has a slot per GOMAXPROCS; a search takes one and waits
+	// while all are taken. Each solver and its ~36 MB table is made on
+	// first use and then kept, so tables are not zeroed move after move.
+	solvers chan *solver.Solver
 }
 
-func NewBotService(gs *GameService) *BotService {
-	return &BotService{
+// NewBotService returns a bot for the games of gs. Its MCTS trees are
+// dropped as their games end.
+func NewBotService(gs *GameService, thinkTime time.Duration) *BotService {
+	bs := &BotService{
 		gameservice: gs,
+		solvers:     make(chan *solver.Solver, runtime.GOMAXPROCS(0)),
+		thinkTime:   thinkTime,
+		trees:       make(map[string]*mctsTree),
+	}
+	for i := 0; i < cap(bs.solvers); i++ {
+		bs.solvers <- nil
+	}
+	gs.AddEndHandler(bs.dropTree)
+	return bs
+}
+
+// SetBook makes the bot play from the opening book for the first plies
+// moves of standard games on the book's board. Easy bots ignore it.
+func (bs *BotService) SetBook(b *book.Book, plies int) {
+	bs.book = b
+	bs.bookPlies = plies
+}
+
+// Name implements Bot.
+func (bs *BotService) Name() string { return "builtin" }
+
+// MakeBotMove picks the bot's next move at the game's difficulty. Column
+// is -1 when the bot has no legal move.
+func (bs *BotService) MakeBotMove(game *models.Game) models.MovePayload {
+	botpiece := pieceFor(game, game.CurrentTurn)
+	pos, err := engine.FromBoard(game.Board, game.WinLength, botpiece)
+	if err != nil {
+		return models.MovePayload{Column: -1}
+	}
+
+	if bs.book != nil && game.Variant == models.VariantStandard &&
+		game.Difficulty != models.DifficultyEasy && pos.Moves() < bs.bookPlies {
+		if col, ok := bs.book.Pick(pos); ok {
+			return models.MovePayload{Column: col, Kind: models.MoveDrop}
+		}
+	}
+
+	// The solver only knows the drop-only rules, so strong PopOut bots
+	// use MCTS instead and the weaker ones the heuristic.
+	switch {
+	case game.Difficulty == models.DifficultyMCTS ||
+		game.Variant == models.VariantPopOut &&
+			(game.Difficulty == models.DifficultyHard || game.Difficulty == models.DifficultyPerfect):
+		if move, ok := bs.mctsMove(game); ok {
+			return move
+		}
+	case game.Variant == models.VariantStandard:
+		switch game.Difficulty {
+		case models.DifficultyEasy:
+			if rand.Float64() < easyBlunderRate {
+				if col := randomDrop(pos); col >= 0 {
+					return models.MovePayload{Column: col, Kind: models.MoveDrop}
+				}
+			}
+		case models.DifficultyMedium:
+			if col := bs.search(pos, mediumDepth, mediumThinkTime); col >= 0 {
+				return models.MovePayload{Column: col, Kind: models.MoveDrop}
+			}
+		case models.DifficultyHard:
+			if col := bs.search(pos, hardDepth, hardThinkTime); col >= 0 {
+				return models.MovePayload{Column: col, Kind: models.MoveDrop}
+			}
+		case models.DifficultyPerfect:
+			if col := bs.solve(pos); col >= 0 {
+				return models.MovePayload{Column: col, Kind: models.MoveDrop}
+			}
+		}
+	}
+	return heuristicMove(game, pos, botpiece)
+}
+
+// getSolver takes a solver from the pool, waiting for one if all are in
+// use, and creates it if its slot is still empty.
+func (bs *BotService) getSolver() *solver.Solver {
+	if s := <-bs.solvers; s != nil {
+		return s
+	}
+	return solver.New(solver.DefaultTableBits)
+}
+
+// putSolver returns a solver taken with getSolver.
+func (bs *BotService) putSolver(s *solver.Solver) {
+	bs.solvers <- s
+}
+
+// search runs a depth- and time-limited search and returns its best
+// column, or -1.
+func (bs *BotService) search(pos *engine.Position, depth int, think time.Duration) int {
+	s := bs.getSolver()
+	defer bs.putSolver(s)
+	r, err := s.Search(pos, depth, time.Now().Add(think))
+	if err != nil {
+		return -1
+	}
+	return r.Column
+}
+
+// solve returns a column that keeps the best game-theoretic outcome, or
+// the hard search's choice if the solve runs out of time.
+func (bs *BotService) solve(pos *engine.Position) int {
+	s := bs.getSolver()
+	r, err := s.Analyze(pos, time.Now().Add(perfectTimeout))
+	bs.putSolver(s)
+	if errors.Is(err, solver.ErrTimeout) {
+		return bs.search(pos, hardDepth, hardThinkTime)
+	}
+	if err != nil {
+		return -1
+	}
+	return r.Column
+}
+
+// Hint implements Hinter. Standard games are solved if that is quick
+// enough and searched deeply otherwise; PopOut games get an MCTS estimate.
+func (bs *BotService) Hint(game *models.Game) (models.HintPayload, error) {
+	pos, err := engine.FromBoard(game.Board, game.WinLength, pieceFor(game, game.CurrentTurn))
+	if err != nil {
+		return models.HintPayload{}, err
+	}
+
+	if game.Variant == models.VariantPopOut {
+		r, err := mcts.New(pos, true, runtime.GOMAXPROCS(0)).Search(hintThinkTime)
+		if err != nil {
+			return models.HintPayload{}, ErrHintFailed
+		}
+		hint := models.HintPayload{
+			Column:  r.Move.Column,
+			Kind:    models.MoveDrop,
+			Outcome: models.OutcomeUnknown,
+			WinRate: r.WinRate,
+		}
+		if r.Move.Pop {
+			hint.Kind = models.MovePop
+		}
+		return hint, nil
+	}
+
+	s := bs.getSolver()
+	defer bs.putSolver(s)
+	r, err := s.Analyze(pos, time.Now().Add(hintThinkTime))
+	if errors.Is(err, solver.ErrTimeout) {
+		r, err = s.Search(pos, hardDepth, time.Now().Add(hardThinkTime))
 	}
+	if err != nil {
+		return models.HintPayload{}, ErrHintFailed
+	}
+	// the solver's outcomes use the same names as the payload's
+	return models.HintPayload{
+		Column:  r.Column,
+		Kind:    models.MoveDrop,
+		Outcome: r.Outcome,
+		Plies:   r.Plies,
+	}, nil
 }
 
-func (bs *BotService) MakeBotMove(game *models.Game) int {
+// randomDrop returns a random playable column, or -1 if the board is full.
+func randomDrop(pos *engine.Position) int {
+	var cols []int
+	for col := 0; col < pos.Columns(); col++ {
+		if pos.CanPlay(col) {
+			cols = append(cols, col)
+		}
+	}
+	if len(cols) == 0 {
+		return -1
+	}
+	return cols[rand.Intn(len(cols))]
+}
+
+// heuristicMove wins if it can, blocks if it must, and otherwise plays
+// towards the center.
+func heuristicMove(game *models.Game, pos *engine.Position, botpiece int) models.MovePayload {
+	popout := game.Variant == models.VariantPopOut
+
 	// Quick win check
-	botpiece := 2
-	for col := 0; col < 7; col++ {
-		if canPlaceInColumn(&game.Board, col) {
-			row := getLowestRow(&game.Board, col)
-			game.Board[row][col] = botpiece
-
-			if bs.gameservice.checkWin(game.Board, botpiece) {
-				game.Board[row][col] = 0
-				return col
+	for col := 0; col < game.Columns; col++ {
+		if pos.CanPlay(col) && pos.IsWinningDrop(botpiece, col) {
+			return models.MovePayload{Column: col, Kind: models.MoveDrop}
+		}
+	}
+	if popout {
+		for col := 0; col < game.Columns; col++ {
+			if pos.CanPop(col) && popResult(*pos, col) == botpiece {
+				return models.MovePayload{Column: col, Kind: models.MovePop}
 			}
-			game.Board[row][col] = 0
 		}
 	}
 
 	// Quick block check - only check critical positions
-	playerPiece := 1
-	for col := 0; col < 7; col++ {
-		if canPlaceInColumn(&game.Board, col) {
-			row := getLowestRow(&game.Board, col)
-			game.Board[row][col] = playerPiece
-
-			if bs.gameservice.checkWin(game.Board, playerPiece) {
-				game.Board[row][col] = 0
-				return col
-			}
-			game.Board[row][col] = 0
+	playerPiece := 3 - botpiece
+	for col := 0; col < game.Columns; col++ {
+		if pos.CanPlay(col) && pos.IsWinningDrop(playerPiece, col) {
+			return models.MovePayload{Column: col, Kind: models.MoveDrop}
 		}
 	}
 
 	// Prefer center columns - fastest heuristic
-	preferredOrder := []int{3, 4, 2, 5, 1, 6, 0}
-	for _, col := range preferredOrder {
-		if canPlaceInColumn(&game.Board, col) {
-			return col
+	for _, col := range preferredOrder(game.Columns) {
+		if pos.CanPlay(col) {
+			return models.MovePayload{Column: col, Kind: models.MoveDrop}
 		}
 	}
 
-	return -1
+	// Board is full: in PopOut, pop a disc that doesn't hand the
+	// opponent a line if there is one.
+	if popout {
+		fallback := -1
+		for _, col := range preferredOrder(game.Columns) {
+			if !pos.CanPop(col) {
+				continue
+			}
+			if fallback == -1 {
+				fallback = col
+			}
+			if popResult(*pos, col) != playerPiece {
+				return models.MovePayload{Column: col, Kind: models.MovePop}
+			}
+		}
+		if fallback != -1 {
+			return models.MovePayload{Column: fallback, Kind: models.MovePop}
+		}
+	}
+
+	return models.MovePayload{Column: -1}
 }
 
-func canPlaceInColumn(board *[6][7]int, column int) bool {
-	if column < 0 || column >= 7 {
-		return false
-	}
-	return board[0][column] == 0
+// popResult returns the winner, if any, after popping column on a copy of
+// the position.
+func popResult(pos engine.Position, column int) int {
+	pos.Pop(column)
+	return pos.Winner()
 }
 
-func getLowestRow(board *[6][7]int, column int) int {
-	for row := 5; row >= 0; row-- {
-		if board[row][column] == 0 {
-			return row
+// preferredOrder lists the columns from the center outwards, e.g.
+// 3, 4, 2, 5, 1, 6, 0 for a 7-column board.
+func preferredOrder(columns int) []int {
+	order := make([]int, 0, columns)
+	center := columns / 2
+	order = append(order, center)
+	for d := 1; len(order) < columns; d++ {
+		if c := center + d; c < columns {
+			order = append(order, c)
+		}
+		if c := center - d; c >= 0 {
+			order = append(order, c)
 		}
 	}
-	return -1 // Column is full
+	return order
 }
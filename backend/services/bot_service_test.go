@@ -0,0 +1,56 @@
+package services
+
+import (
+	"4-in-a-row/engine"
+	"4-in-a-row/solver"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestSolverPool runs more searches at once than the pool has solvers and
+// checks that no more solvers are made, and that later searches reuse them.
+func TestSolverPool(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(2))
+	bs := NewBotService(NewGameService(), 0)
+	pos, _ := engine.New(6, 7, 4)
+
+	searchAll := func() map[*solver.Solver]bool {
+		var wg sync.WaitGroup
+		for i := 0; i < 6; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if col := bs.search(pos, mediumDepth, 20*time.Millisecond); !pos.CanPlay(col) {
+					t.Errorf("search returned column %d", col)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if len(bs.solvers) != 2 {
+			t.Fatalf("%d solvers back in the pool, want 2", len(bs.solvers))
+		}
+		seen := make(map[*solver.Solver]bool)
+		for i := 0; i < 2; i++ {
+			s := <-bs.solvers
+			if s != nil {
+				seen[s] = true
+			}
+			defer func() { bs.solvers <- s }()
+		}
+		return seen
+	}
+
+	// Six searches take both empty slots, so both solvers exist now
+	first := searchAll()
+	if len(first) != 2 {
+		t.Fatalf("%d solvers made, want 2", len(first))
+	}
+	for s := range searchAll() {
+		if !first[s] {
+			t.Error("a solver was made for a full pool")
+		}
+	}
+}
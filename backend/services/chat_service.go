@@ -0,0 +1,196 @@
+package services
+
+import (
+	"bufio"
+	"errors"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	ErrChatTooLong     = errors.New("chat message is too long")
+	ErrChatRateLimited = errors.New("sending chat messages too fast")
+)
+
+const (
+	// chatBurst is how many messages a sender may send at once before the
+	// per-minute rate applies.
+	chatBurst = 5
+	// botChatCooldown keeps the bot from answering every line.
+	botChatCooldown = 10 * time.Second
+)
+
+// Canned bot answers, by what the player said.
+var (
+	botGreetings  = []string{"Hello! Good luck.", "Hi there! May the best player win."}
+	botGoodGames  = []string{"Good game!", "gg, well played."}
+	botSmallTalk  = []string{"Interesting.", "Hmm, let me think about that.", "I'm only a bot, but I'm enjoying this game.", "Nice try!"}
+	greetingWords = map[string]bool{"hi": true, "hello": true, "hey": true, "hola": true}
+	goodGameWords = map[string]bool{"gg": true, "wp": true, "ggwp": true}
+)
+
+// isWordBreak reports whether r separates words for the filter.
+func isWordBreak(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
+
+// chatBucket is a token bucket for one sender.
+type chatBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// ChatService checks chat messages before they are sent: their length,
+// how often each sender chats and words on the filter list, which are
+// masked.
+type ChatService struct {
+	maxLength  int
+	perMinute  int
+	filter     map[string]bool
+	buckets    map[string]*chatBucket
+	botReplies map[string]time.Time // game ID -> time of the bot's last answer
+	mu         sync.Mutex
+}
+
+func NewChatService(maxLength, perMinute int, words []string) *ChatService {
+	filter := make(map[string]bool, len(words))
+	for _, w := range words {
+		filter[strings.ToLower(w)] = true
+	}
+	return &ChatService{
+		maxLength:  maxLength,
+		perMinute:  perMinute,
+		filter:     filter,
+		buckets:    make(map[string]*chatBucket),
+		botReplies: make(map[string]time.Time),
+	}
+}
+
+// LoadWordList reads a chat filter word list, one word per line. Blank
+// lines and lines starting with # are skipped.
+func LoadWordList(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var words []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		w := strings.TrimSpace(scanner.Text())
+		if w != "" && !strings.HasPrefix(w, "#") {
+			words = append(words, w)
+		}
+	}
+	return words, scanner.Err()
+}
+
+// Prepare checks a message from sender and returns its text as it will be
+// shown: trimmed, with filtered words masked.
+func (cs *ChatService) Prepare(sender, text string) (string, error) {
+	text = strings.TrimSpace(text)
+	if utf8.RuneCountInString(text) > cs.maxLength {
+		return "", ErrChatTooLong
+	}
+	if !cs.allow(sender, time.Now()) {
+		return "", ErrChatRateLimited
+	}
+	return cs.mask(text), nil
+}
+
+// allow takes a token from sender's bucket if there is one.
+func (cs *ChatService) allow(sender string, now time.Time) bool {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	capacity := float64(min(chatBurst, cs.perMinute))
+	b := cs.buckets[sender]
+	if b == nil {
+		cs.sweep(now, capacity)
+		b = &chatBucket{tokens: capacity, last: now}
+		cs.buckets[sender] = b
+	}
+	b.tokens = min(capacity, b.tokens+now.Sub(b.last).Minutes()*float64(cs.perMinute))
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// sweep drops the buckets that have refilled, which a new bucket would
+// replace as they are. Buckets are kept when a client disconnects, so
+// that reconnecting doesn't reset the limit. Must be called with cs.mu
+// held.
+func (cs *ChatService) sweep(now time.Time, capacity float64) {
+	for sender, b := range cs.buckets {
+		if b.tokens+now.Sub(b.last).Minutes()*float64(cs.perMinute) >= capacity {
+			delete(cs.buckets, sender)
+		}
+	}
+}
+
+// mask replaces every filtered word in text with asterisks.
+func (cs *ChatService) mask(text string) string {
+	if len(cs.filter) == 0 {
+		return text
+	}
+	var b strings.Builder
+	var word []rune
+	flush := func() {
+		if cs.filter[strings.ToLower(string(word))] {
+			b.WriteString(strings.Repeat("*", len(word)))
+		} else {
+			b.WriteString(string(word))
+		}
+		word = word[:0]
+	}
+	for _, r := range text {
+		if isWordBreak(r) {
+			flush()
+			b.WriteRune(r)
+			continue
+		}
+		word = append(word, r)
+	}
+	flush()
+	return b.String()
+}
+
+// BotReply returns the bot's canned answer to a player's chat line in a
+// bot game. ok is false if the bot answered too recently.
+func (cs *ChatService) BotReply(gameID, text string) (reply string, ok bool) {
+	now := time.Now()
+	cs.mu.Lock()
+	for id, t := range cs.botReplies {
+		if now.Sub(t) > botChatCooldown {
+			delete(cs.botReplies, id)
+		}
+	}
+	if _, recent := cs.botReplies[gameID]; recent {
+		cs.mu.Unlock()
+		return "", false
+	}
+	cs.botReplies[gameID] = now
+	cs.mu.Unlock()
+
+	replies := botSmallTalk
+	for _, w := range strings.FieldsFunc(strings.ToLower(text), isWordBreak) {
+		if greetingWords[w] {
+			replies = botGreetings
+			break
+		}
+		if goodGameWords[w] {
+			replies = botGoodGames
+			break
+		}
+	}
+	return replies[rand.Intn(len(replies))], true
+}
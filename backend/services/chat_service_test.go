@@ -0,0 +1,54 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestChatRateLimit spends a sender's burst and checks that the bucket
+// refills at the per-minute rate and is only dropped once it is full.
+func TestChatRateLimit(t *testing.T) {
+	cs := NewChatService(100, 60, nil)
+	start := time.Now()
+	for i := 0; i < chatBurst; i++ {
+		if !cs.allow("a", start) {
+			t.Fatalf("message %d of the burst refused", i+1)
+		}
+	}
+	if cs.allow("a", start) {
+		t.Fatal("message after the burst allowed")
+	}
+	if _, err := cs.Prepare("a", "hi"); !errors.Is(err, ErrChatRateLimited) {
+		t.Errorf("Prepare after the burst: %v, want ErrChatRateLimited", err)
+	}
+
+	// One message a second comes back
+	if !cs.allow("a", start.Add(1100*time.Millisecond)) || cs.allow("a", start.Add(1200*time.Millisecond)) {
+		t.Error("bucket did not refill at one message a second")
+	}
+
+	// A new sender sweeps the buckets; a's is kept while it is refilling
+	cs.allow("b", start.Add(2*time.Second))
+	if _, ok := cs.buckets["a"]; !ok {
+		t.Fatal("bucket dropped while refilling")
+	}
+	cs.allow("c", start.Add(10*time.Second))
+	if _, ok := cs.buckets["a"]; ok {
+		t.Error("full bucket kept")
+	}
+}
+
+func TestChatFilter(t *testing.T) {
+	cs := NewChatService(20, 60, []string{"Darn"})
+	text, err := cs.Prepare("a", "  darn, DARN!  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "****, ****!" {
+		t.Errorf("Prepare = %q, want the words masked and trimmed", text)
+	}
+	if _, err := cs.Prepare("a", "this message is far too long"); !errors.Is(err, ErrChatTooLong) {
+		t.Errorf("long message: %v, want ErrChatTooLong", err)
+	}
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"4-in-a-row/engine"
+	"4-in-a-row/models"
+	"errors"
+	"time"
+)
+
+var ErrTimeExpired = errors.New("your clock has run out")
+
+// SetTimeoutHandler registers fn to receive a snapshot of every game that
+// ends because a player's clock ran out. fn runs on its own goroutine.
+func (gs *GameService) SetTimeoutHandler(fn func(game *models.Game)) {
+	gs.mu.Lock()
+	gs.onTimeout = fn
+	gs.mu.Unlock()
+}
+
+// playTimed applies a move and runs the clocks: the mover is charged for
+// their thinking time, gets their increment, and the opponent's clock
+// starts. A move that arrives after the mover's flag fell is rejected.
+func (gs *GameService) playTimed(gameID, playerID string, apply func(*models.Game, *engine.Position) error) (*models.Game, error) {
+	return gs.updateRecord(gameID, func(rec *gameRecord) error {
+		game := rec.game
+		now := time.Now()
+		timed := game.TimeControl.Timed() && game.Status == "active" && game.CurrentTurn == playerID
+		var left time.Duration
+		if timed {
+			left = game.RemainingFor(playerID, now)
+			if left <= 0 {
+				return ErrTimeExpired
+			}
+		}
+
+		if err := apply(game, rec.pos); err != nil {
+			return err
+		}
+
+		if timed {
+			tc := game.TimeControl
+			if tc.PerMove > 0 {
+				left = time.Duration(tc.PerMove) * time.Second
+			} else {
+				left += time.Duration(tc.Increment) * time.Second
+			}
+			chargeTime(game, playerID, left)
+			gs.startClock(rec, now)
+		}
+		return nil
+	})
+}
+
+// chargeTime sets playerID's remaining time.
+func chargeTime(game *models.Game, playerID string, left time.Duration) {
+	if !game.TimeControl.Timed() {
+		return
+	}
+	if playerID == game.Player1ID {
+		game.Player1TimeMs = left.Milliseconds()
+	} else {
+		game.Player2TimeMs = left.Milliseconds()
+	}
+}
+
+// startClock starts the clock of the player to move at now and arms the
+// timeout timer. Must be called with rec.mu held.
+func (gs *GameService) startClock(rec *gameRecord, now time.Time) {
+	gs.stopClock(rec)
+	game := rec.game
+	if !game.TimeControl.Timed() {
+		return
+	}
+	game.TurnStartedAt = now
+	if game.Status != "active" {
+		return
+	}
+	gs.armClock(rec, game.RemainingFor(game.CurrentTurn, now))
+}
+
+func (gs *GameService) armClock(rec *gameRecord, after time.Duration) {
+	gameID, gen := rec.game.ID, rec.clockGen
+	rec.timer = time.AfterFunc(after, func() {
+		gs.expireClock(gameID, gen)
+	})
+}
+
+// stopClock cancels the pending timeout. Must be called with rec.mu held.
+func (gs *GameService) stopClock(rec *gameRecord) {
+	rec.clockGen++
+	if rec.timer != nil {
+		rec.timer.Stop()
+		rec.timer = nil
+	}
+}
+
+// expireClock ends the game when the running clock has run out, awarding
+// the win to the opponent, and notifies the timeout handler.
+func (gs *GameService) expireClock(gameID string, gen int) {
+	gs.mu.RLock()
+	rec, exists := gs.games[gameID]
+	onTimeout := gs.onTimeout
+	gs.mu.RUnlock()
+	if !exists {
+		return
+	}
+
+	rec.mu.Lock()
+	game := rec.game
+	if rec.clockGen != gen || game.Status != "active" {
+		rec.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	if left := game.RemainingFor(game.CurrentTurn, now); left > 0 {
+		gs.armClock(rec, left)
+		rec.mu.Unlock()
+		return
+	}
+	chargeTime(game, game.CurrentTurn, 0)
+	game.TurnStartedAt = now
+	game.Status = "timeout"
+	game.Winner = opponentOf(game, game.CurrentTurn)
+	game.TakebackRequestedBy = ""
+	game.DrawOfferedBy = ""
+	game.UpdatedAt = now
+	rec.timer = nil
+	snapshot := game.Clone()
+	rec.mu.Unlock()
+
+	gs.ended(gameID)
+	if onTimeout != nil {
+		onTimeout(snapshot)
+	}
+}
@@ -0,0 +1,159 @@
+package services
+
+import (
+	"4-in-a-row/models"
+	"errors"
+	"testing"
+	"time"
+)
+
+// storeTimed stores a game between "a" and opponent with the given clocks.
+// A non-zero started backdates the start of a's turn and leaves the flag
+// unarmed; otherwise a's clock starts now.
+func storeTimed(t *testing.T, gs *GameService, opponent string, tc models.TimeControl, aMs, opponentMs int64, started time.Time) *models.Game {
+	t.Helper()
+	opts := models.DefaultGameOptions()
+	opts.TimeControl = tc
+	game := models.NewGame("timed-"+opponent, "a", "a", opponent, opponent, opponent == "bot", opts)
+	game.Player1TimeMs, game.Player2TimeMs = aMs, opponentMs
+	game.TurnStartedAt = started
+	game, err := gs.StoreGame(game)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return game
+}
+
+// awaitTimeout waits for the timeout handler to report a game.
+func awaitTimeout(t *testing.T, timeouts <-chan *models.Game) *models.Game {
+	t.Helper()
+	select {
+	case game := <-timeouts:
+		return game
+	case <-time.After(2 * time.Second):
+		t.Fatal("no flag fell")
+		return nil
+	}
+}
+
+func timeoutChannel(gs *GameService) <-chan *models.Game {
+	timeouts := make(chan *models.Game, 1)
+	gs.SetTimeoutHandler(func(game *models.Game) { timeouts <- game })
+	return timeouts
+}
+
+func TestClockCharging(t *testing.T) {
+	tests := []struct {
+		name string
+		tc   models.TimeControl
+		want int64 // a's clock after moving 5s into a 60s turn
+	}{
+		{"untimed", models.TimeControl{}, 60000},
+		{"sudden death", models.TimeControl{Initial: 60}, 55000},
+		{"increment", models.TimeControl{Initial: 60, Increment: 2}, 57000},
+		{"per move", models.TimeControl{PerMove: 10}, 10000},
+	}
+	for _, tt := range tests {
+		gs := NewGameService()
+		game := storeTimed(t, gs, "b", tt.tc, 60000, 60000, time.Now().Add(-5*time.Second))
+		game, err := gs.PlayMove(game.ID, "a", models.MovePayload{Column: 3})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		// Allow for the time the move itself took
+		if got := game.Player1TimeMs; got > tt.want || got < tt.want-200 {
+			t.Errorf("%s: a has %dms after the move, want %dms", tt.name, got, tt.want)
+		}
+		if game.Player2TimeMs != 60000 {
+			t.Errorf("%s: b has %dms before moving, want 60000ms", tt.name, game.Player2TimeMs)
+		}
+		if timed := tt.tc.Timed(); timed && game.ClockAt(time.Now()).Running != "b" {
+			t.Errorf("%s: b's clock is not running", tt.name)
+		}
+		gs.DeleteGame(game.ID)
+	}
+}
+
+// TestMoveAfterFlag plays a move that arrives after the mover's time ran
+// out but before the timer ended the game.
+func TestMoveAfterFlag(t *testing.T) {
+	gs := NewGameService()
+	game := storeTimed(t, gs, "b", models.TimeControl{Initial: 60, Increment: 2}, 1000, 60000, time.Now().Add(-2*time.Second))
+	if _, err := gs.PlayMove(game.ID, "a", models.MovePayload{Column: 3}); !errors.Is(err, ErrTimeExpired) {
+		t.Fatalf("late move: %v, want ErrTimeExpired", err)
+	}
+	if game, _ = gs.GetGame(game.ID); game.Status != "active" || len(game.Moves) != 0 {
+		t.Errorf("after a late move: %s with %d moves", game.Status, len(game.Moves))
+	}
+}
+
+func TestFlagFall(t *testing.T) {
+	gs := NewGameService()
+	timeouts := timeoutChannel(gs)
+
+	// a moves with time to spare, which must disarm a's flag
+	tc := models.TimeControl{Initial: 60, Increment: 2}
+	game := storeTimed(t, gs, "b", tc, 100, 60000, time.Time{})
+	if _, err := gs.PlayMove(game.ID, "a", models.MovePayload{Column: 3}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case game := <-timeouts:
+		t.Fatalf("flag fell for %s after a moved in time", opponentOf(game, game.Winner))
+	case <-time.After(300 * time.Millisecond):
+	}
+	gs.DeleteGame(game.ID)
+
+	game = storeTimed(t, gs, "b", tc, 50, 60000, time.Time{})
+	ended := awaitTimeout(t, timeouts)
+	if ended.ID != game.ID || ended.Status != "timeout" || ended.Winner != "b" {
+		t.Fatalf("game %s %s, won by %q; want a timeout won by b", ended.ID, ended.Status, ended.Winner)
+	}
+	if ended.Player1TimeMs != 0 || ended.Player2TimeMs != 60000 {
+		t.Errorf("clocks %dms and %dms after the flag fell", ended.Player1TimeMs, ended.Player2TimeMs)
+	}
+	if _, err := gs.PlayMove(game.ID, "a", models.MovePayload{Column: 3}); !errors.Is(err, ErrGameNotActive) {
+		t.Errorf("move after the flag fell: %v, want ErrGameNotActive", err)
+	}
+}
+
+// TestBotClock checks that the bot's thinking runs its own clock, which
+// gets the increment and can run out like anyone's.
+func TestBotClock(t *testing.T) {
+	gs := NewGameService()
+	bs := NewBotService(gs, 0)
+	timeouts := timeoutChannel(gs)
+
+	game := storeTimed(t, gs, "bot", models.TimeControl{Initial: 60, Increment: 2}, 60000, 60000, time.Time{})
+	game, err := gs.PlayMove(game.ID, "a", models.MovePayload{Column: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	move := bs.MakeBotMove(game)
+	if game, err = gs.PlayMove(game.ID, "bot", move); err != nil {
+		t.Fatal(err)
+	}
+	thought := time.Since(start).Milliseconds()
+	if got := game.Player2TimeMs; got > 62000-thought || got < 62000-thought-200 {
+		t.Errorf("bot has %dms after thinking %dms, want about %dms", got, thought, 62000-thought)
+	}
+	gs.DeleteGame(game.ID)
+
+	// The bot's flag falls while it is on move
+	opts := models.DefaultGameOptions()
+	opts.TimeControl = models.TimeControl{Initial: 60}
+	game = models.NewGame("bot-flag", "a", "a", "bot", "bot", true, opts)
+	game.CurrentTurn = "bot"
+	game.Player2TimeMs = 50
+	if game, err = gs.StoreGame(game); err != nil {
+		t.Fatal(err)
+	}
+	ended := awaitTimeout(t, timeouts)
+	if ended.ID != game.ID || ended.Status != "timeout" || ended.Winner != "a" {
+		t.Fatalf("game %s %s, won by %q; want a timeout won by a", ended.ID, ended.Status, ended.Winner)
+	}
+	if _, err := gs.PlayMove(game.ID, "bot", bs.MakeBotMove(game)); !errors.Is(err, ErrGameNotActive) {
+		t.Errorf("bot move after its flag fell: %v, want ErrGameNotActive", err)
+	}
+}
@@ -0,0 +1,325 @@
+package services
+
+import (
+	"4-in-a-row/engine"
+	"4-in-a-row/models"
+	"4-in-a-row/notation"
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ExternalBot runs an engine as child processes and talks to them over
+// stdin/stdout with a line-based protocol in the spirit of UCI:
+//
+//	> c4i
+//	< id name <engine name>          (optional)
+//	< c4iok
+//	> position <rows> <columns> <win length> <variant> moves <moves>
+//	> go movetime <milliseconds>
+//	< info <anything>                (optional, ignored)
+//	< bestmove <move>
+//	> quit
+//
+// Moves use column-sequence notation (1-based columns, "p" before a pop),
+// so "moves 4453" is the game so far and "bestmove 4" drops into the
+// middle column of a 7-column board. The moves list is empty at the start
+// of a game. The engine should exit when it reads quit or its stdin
+// closes.
+//
+// Moves are searched by a fixed pool of processes, one move per process
+// at a time, so a move waits only while every process is busy. Processes
+// are started on first use and restarted after they crash, misbehave or
+// overrun their time budget. While one is unavailable, its moves come
+// from the fallback bot.
+//
+// The engine's only strength setting is its time: the game's difficulty
+// scales the move time, see engineTimeScale.
+type ExternalBot struct {
+	command  []string
+	moveTime time.Duration // at the default difficulty
+	fallback Bot
+	procs    chan *engineProcess // idle processes
+
+	mu   sync.Mutex // guards name
+	name string
+}
+
+// engineProcess is one running engine, or a slot for one that is started
+// on its next move.
+type engineProcess struct {
+	command []string
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	lines   chan string // stdout, closed when the process exits
+}
+
+const (
+	// engineHandshakeTimeout bounds the wait for c4iok.
+	engineHandshakeTimeout = 5 * time.Second
+	// engineGrace is how long past its movetime an engine may take to
+	// answer before it is killed.
+	engineGrace = 500 * time.Millisecond
+)
+
+// engineTimeScale scales the move time by difficulty, relative to the
+// default difficulty.
+var engineTimeScale = map[string]float64{
+	models.DifficultyEasy:    0.25,
+	models.DifficultyMedium:  1,
+	models.DifficultyHard:    2,
+	models.DifficultyPerfect: 4,
+	models.DifficultyMCTS:    1,
+}
+
+var (
+	ErrEngineTimeout  = errors.New("engine did not answer in time")
+	ErrEngineExited   = errors.New("engine exited")
+	ErrEngineBadReply = errors.New("engine sent an invalid move")
+)
+
+// NewExternalBot returns a bot backed by up to processes copies of the
+// engine started with command (program and arguments), thinking for
+// moveTime per move at the default difficulty.
+func NewExternalBot(command []string, moveTime time.Duration, processes int, fallback Bot) *ExternalBot {
+	eb := &ExternalBot{
+		command:  command,
+		moveTime: moveTime,
+		fallback: fallback,
+		procs:    make(chan *engineProcess, processes),
+	}
+	for i := 0; i < processes; i++ {
+		eb.procs <- &engineProcess{command: command}
+	}
+	return eb
+}
+
+// Name implements Bot. It is the name the engine reported, or its program.
+func (eb *ExternalBot) Name() string {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+	if eb.name != "" {
+		return eb.name
+	}
+	return eb.command[0]
+}
+
+// MakeBotMove implements Bot.
+func (eb *ExternalBot) MakeBotMove(game *models.Game) models.MovePayload {
+	move, err := eb.bestMove(game)
+	if err != nil {
+		log.Printf("External engine %s: %v; using %s\n", eb.command[0], err, eb.fallback.Name())
+		return eb.fallback.MakeBotMove(game)
+	}
+	return move
+}
+
+// Hint implements Hinter with the fallback bot, since the protocol has no
+// way to ask for an evaluation.
+func (eb *ExternalBot) Hint(game *models.Game) (models.HintPayload, error) {
+	h, ok := eb.fallback.(Hinter)
+	if !ok {
+		return models.HintPayload{}, ErrHintsUnavailable
+	}
+	return h.Hint(game)
+}
+
+// Close asks every engine process to quit, once it has finished its
+// move, and waits for them to exit.
+func (eb *ExternalBot) Close() {
+	procs := make([]*engineProcess, cap(eb.procs))
+	for i := range procs {
+		procs[i] = <-eb.procs
+		procs[i].quit()
+	}
+	for _, p := range procs {
+		eb.procs <- p
+	}
+}
+
+// moveTimeFor returns the engine's time per move at difficulty.
+func (eb *ExternalBot) moveTimeFor(difficulty string) time.Duration {
+	scale, ok := engineTimeScale[difficulty]
+	if !ok {
+		scale = 1
+	}
+	return time.Duration(float64(eb.moveTime) * scale)
+}
+
+func (eb *ExternalBot) bestMove(game *models.Game) (models.MovePayload, error) {
+	p := <-eb.procs
+	defer func() { eb.procs <- p }()
+
+	if p.cmd == nil {
+		name, err := p.start()
+		if err != nil {
+			return models.MovePayload{}, err
+		}
+		if name != "" {
+			eb.mu.Lock()
+			eb.name = name
+			eb.mu.Unlock()
+		}
+	}
+
+	moveTime := eb.moveTimeFor(game.Difficulty)
+	_, err := fmt.Fprintf(p.stdin, "position %d %d %d %s moves %s\ngo movetime %d\n",
+		game.Rows, game.Columns, game.WinLength, game.Variant,
+		notation.FormatMoves(game.Moves), moveTime.Milliseconds())
+	if err != nil {
+		p.stop()
+		return models.MovePayload{}, err
+	}
+
+	deadline := time.After(moveTime + engineGrace)
+	for {
+		line, err := p.readLine(deadline)
+		if err != nil {
+			p.stop()
+			return models.MovePayload{}, err
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 || fields[0] != "bestmove" {
+			continue
+		}
+		if len(fields) != 2 {
+			p.stop()
+			return models.MovePayload{}, fmt.Errorf("%w: %q", ErrEngineBadReply, line)
+		}
+		move, err := parseEngineMove(game, fields[1])
+		if err != nil {
+			p.stop()
+			return models.MovePayload{}, err
+		}
+		return move, nil
+	}
+}
+
+// start launches the engine and waits for the handshake. It returns the
+// name the engine reported, if any.
+func (p *engineProcess) start() (name string, err error) {
+	cmd := exec.Command(p.command[0], p.command[1:]...)
+	cmd.Stderr = os.Stderr // engine diagnostics go to the server log
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return "", err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return "", err
+	}
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+
+	lines := make(chan string, 16)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+	p.cmd, p.stdin, p.lines = cmd, stdin, lines
+
+	if _, err := fmt.Fprintln(stdin, "c4i"); err != nil {
+		p.stop()
+		return "", err
+	}
+	deadline := time.After(engineHandshakeTimeout)
+	for {
+		line, err := p.readLine(deadline)
+		if err != nil {
+			p.stop()
+			return "", err
+		}
+		switch {
+		case strings.HasPrefix(line, "id name "):
+			name = strings.TrimSpace(strings.TrimPrefix(line, "id name "))
+		case strings.TrimSpace(line) == "c4iok":
+			log.Printf("External engine %s ready (pid %d)\n", p.command[0], cmd.Process.Pid)
+			return name, nil
+		}
+	}
+}
+
+// readLine returns the engine's next output line.
+func (p *engineProcess) readLine(deadline <-chan time.Time) (string, error) {
+	select {
+	case line, ok := <-p.lines:
+		if !ok {
+			return "", ErrEngineExited
+		}
+		return line, nil
+	case <-deadline:
+		return "", ErrEngineTimeout
+	}
+}
+
+// quit asks the engine to exit and waits for it.
+func (p *engineProcess) quit() {
+	if p.cmd == nil {
+		return
+	}
+	fmt.Fprintln(p.stdin, "quit")
+	p.stdin.Close()
+	p.wait(false)
+}
+
+// stop kills the engine so that the next move starts a fresh one.
+func (p *engineProcess) stop() {
+	if p.cmd == nil {
+		return
+	}
+	p.stdin.Close()
+	p.wait(true)
+}
+
+// wait discards the engine's remaining output and reaps the process,
+// killing it right away or once it has had engineGrace to exit.
+func (p *engineProcess) wait(kill bool) {
+	if kill {
+		p.cmd.Process.Kill()
+	}
+	done := make(chan struct{})
+	go func(lines <-chan string) {
+		for range lines {
+		}
+		close(done)
+	}(p.lines)
+	select {
+	case <-done:
+	case <-time.After(engineGrace):
+		p.cmd.Process.Kill()
+	}
+	p.cmd.Wait()
+	p.cmd = nil
+}
+
+// parseEngineMove reads a bestmove token and checks that it is legal.
+func parseEngineMove(game *models.Game, token string) (models.MovePayload, error) {
+	moves, err := notation.ParseMoves(token, game.Columns)
+	if err != nil || len(moves) != 1 {
+		return models.MovePayload{}, fmt.Errorf("%w: %q", ErrEngineBadReply, token)
+	}
+	move := moves[0]
+	pos, err := engine.FromBoard(game.Board, game.WinLength, pieceFor(game, game.CurrentTurn))
+	if err != nil {
+		return models.MovePayload{}, err
+	}
+	legal := pos.CanPlay(move.Column)
+	if move.Kind == models.MovePop {
+		legal = game.Variant == models.VariantPopOut && pos.CanPop(move.Column)
+	}
+	if !legal {
+		return models.MovePayload{}, fmt.Errorf("%w: %q is not legal", ErrEngineBadReply, token)
+	}
+	return move, nil
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"4-in-a-row/models"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// slowEngine answers every search with the middle column after a fifth of
+// a second, whatever its move time.
+const slowEngine = `#!/bin/sh
+while read cmd rest; do
+	case "$cmd" in
+	c4i) echo "id name slow"; echo c4iok ;;
+	go) sleep 0.2; echo "bestmove 4" ;;
+	quit) exit 0 ;;
+	esac
+done
+`
+
+// noBot stands in for the fallback, so that its moves stand out.
+type noBot struct{}
+
+func (noBot) Name() string                                { return "none" }
+func (noBot) MakeBotMove(*models.Game) models.MovePayload { return models.MovePayload{Column: -1} }
+
+func writeEngine(t *testing.T, script string) []string {
+	t.Helper()
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no shell to run the test engine")
+	}
+	path := filepath.Join(t.TempDir(), "engine.sh")
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return []string{"sh", path}
+}
+
+// TestExternalBotPool plays four moves at once on two engine processes:
+// they take two rounds of searching, not one or four.
+func TestExternalBotPool(t *testing.T) {
+	eb := NewExternalBot(writeEngine(t, slowEngine), time.Second, 2, noBot{})
+	defer eb.Close()
+	game := models.NewGame("g", "a", "a", "bot", "bot", true, models.DefaultGameOptions())
+
+	// Start both processes, so that only the searches are timed
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			eb.MakeBotMove(game)
+		}()
+	}
+	wg.Wait()
+
+	start := time.Now()
+	moves := make(chan models.MovePayload, 4)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			moves <- eb.MakeBotMove(game)
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	close(moves)
+
+	for move := range moves {
+		if move.Column != 3 {
+			t.Errorf("move %+v, want the engine's column 3", move)
+		}
+	}
+	if elapsed < 400*time.Millisecond || elapsed > 750*time.Millisecond {
+		t.Errorf("four moves on two processes took %v, want about 400ms", elapsed)
+	}
+	if eb.Name() != "slow" {
+		t.Errorf("Name() = %q, want the engine's name", eb.Name())
+	}
+}
+
+func TestEngineMoveTime(t *testing.T) {
+	eb := NewExternalBot([]string{"engine"}, time.Second, 1, noBot{})
+	tests := []struct {
+		difficulty string
+		want       time.Duration
+	}{
+		{models.DifficultyEasy, 250 * time.Millisecond},
+		{models.DifficultyMedium, time.Second},
+		{models.DifficultyHard, 2 * time.Second},
+		{models.DifficultyPerfect, 4 * time.Second},
+		{models.DifficultyMCTS, time.Second},
+		{"", time.Second},
+	}
+	for _, tt := range tests {
+		if got := eb.moveTimeFor(tt.difficulty); got != tt.want {
+			t.Errorf("moveTimeFor(%q) = %v, want %v", tt.difficulty, got, tt.want)
+		}
+	}
+}
@@ -1,163 +1,708 @@
 package services
 
 import (
+	"4-in-a-row/engine"
 	"4-in-a-row/models"
 	"errors"
-	"fmt"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 )
 
 var (
-	ErrGameNotFound   = errors.New("game not found")
-	ErrGameNotActive  = errors.New("game is not active")
-	ErrNotPlayersTurn = errors.New("not player's turn")
-	ErrInvalidColumn  = errors.New("invalid column")
-	ErrColumnFull     = errors.New("column is full")
+	ErrGameNotFound    = errors.New("game not found")
+	ErrGameNotActive   = errors.New("game is not active")
+	ErrNotPlayersTurn  = errors.New("not player's turn")
+	ErrInvalidColumn   = errors.New("invalid column")
+	ErrColumnFull      = errors.New("column is full")
+	ErrPopNotAllowed   = errors.New("pop moves are not allowed in this variant")
+	ErrCannotPop       = errors.New("no disc of yours at the bottom of this column")
+	ErrInvalidMoveKind = errors.New("invalid move kind")
+
+	ErrNotInGame            = errors.New("player is not in this game")
+	ErrTakebackPending      = errors.New("a takeback request is already pending")
+	ErrNoTakebackRequest    = errors.New("no takeback request to answer")
+	ErrNothingToTakeBack    = errors.New("no move to take back")
+	ErrNotTakebackResponder = errors.New("only the opponent can answer a takeback request")
+	ErrDrawOfferPending     = errors.New("a draw offer is already pending")
+	ErrNoDrawOffer          = errors.New("no draw offer to answer")
+	ErrNotDrawResponder     = errors.New("only the opponent can answer a draw offer")
+	ErrNoHintsLeft          = errors.New("no hints left in this game")
+	ErrGameInProgress       = errors.New("game is still in progress")
+	ErrRematchPending       = errors.New("a rematch offer is already pending")
+	ErrNoRematchOffer       = errors.New("no rematch offer to answer")
+	ErrNotRematchResponder  = errors.New("only the opponent can answer a rematch offer")
+	ErrRematchStarted       = errors.New("a rematch has already started")
 )
 
+// gameRecord owns one game. Its lock serializes every change to the game,
+// so moves for a game are applied one at a time while different games
+// proceed in parallel. Callers only ever see clones of game.
+type gameRecord struct {
+	mu   sync.Mutex
+	game *models.Game
+	pos  *engine.Position // bitboard mirror of game.Board
+
+	timer    *time.Timer // fires when the running clock runs out
+	clockGen int         // bumped on every restart so stale timers are ignored
+}
+
 type GameService struct {
-	games map[string]*models.Game
-	mu    sync.RWMutex
+	games     map[string]*gameRecord
+	mu        sync.RWMutex // guards the games map and handlers, not the records
+	onTimeout func(game *models.Game)
+	onEnd     []func(gameID string)
 }
 
 func NewGameService() *GameService {
 	return &GameService{
-		games: make(map[string]*models.Game),
+		games: make(map[string]*gameRecord),
 	}
 }
 
-func (gs *GameService) CreateGame(player1ID, player1Name, player2ID, player2Name string, isBot bool) *models.Game {
-	game := &models.Game{
-		ID:          uuid.New().String(),
-		Player1ID:   player1ID,
-		Player1Name: player1Name,
-		Player2ID:   player2ID,
-		Player2Name: player2Name,
-		CurrentTurn: player1ID,
-		Status:      "active",
-		IsBot:       isBot,
+func (gs *GameService) CreateGame(player1ID, player1Name, player2ID, player2Name string, isBot bool, opts models.GameOptions) (*models.Game, error) {
+	opts, err := opts.Normalize()
+	if err != nil {
+		return nil, err
+	}
+	game := models.NewGame(uuid.New().String(), player1ID, player1Name, player2ID, player2Name, isBot, opts)
+	return gs.StoreGame(game)
+}
+
+// StoreGame registers a game created elsewhere, e.g. by matchmaking, and
+// returns a snapshot of it. The service keeps its own copy, so the caller
+// may not use game to change the stored state. Storing a game ID that is
+// already registered returns the existing game, which lets both matched
+// players store the same game.
+func (gs *GameService) StoreGame(game *models.Game) (*models.Game, error) {
+	gs.mu.RLock()
+	_, exists := gs.games[game.ID]
+	gs.mu.RUnlock()
+	if exists {
+		return gs.GetGame(game.ID)
+	}
+
+	pos, err := engine.FromBoard(game.Board, game.WinLength, pieceFor(game, game.CurrentTurn))
+	if err != nil {
+		return nil, err
 	}
+	rec := &gameRecord{game: game.Clone(), pos: pos}
+
 	gs.mu.Lock()
-	gs.games[game.ID] = game
+	if existing, ok := gs.games[game.ID]; ok {
+		rec = existing
+	} else {
+		gs.games[game.ID] = rec
+	}
 	gs.mu.Unlock()
-	return game
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if rec.game.TurnStartedAt.IsZero() {
+		gs.startClock(rec, time.Now())
+	}
+	return rec.game.Clone(), nil
 }
 
-func (gs *GameService) StoreGame(game *models.Game) {
+// update runs fn with the game's lock held and returns a snapshot of the
+// game afterwards. fn must not keep references to game or pos.
+func (gs *GameService) update(gameID string, fn func(game *models.Game, pos *engine.Position) error) (*models.Game, error) {
+	return gs.updateRecord(gameID, func(rec *gameRecord) error {
+		return fn(rec.game, rec.pos)
+	})
+}
+
+// updateRecord is update for changes that also touch the record itself,
+// such as the clock timer.
+func (gs *GameService) updateRecord(gameID string, fn func(rec *gameRecord) error) (*models.Game, error) {
+	gs.mu.RLock()
+	rec, exists := gs.games[gameID]
+	gs.mu.RUnlock()
+	if !exists {
+		return nil, ErrGameNotFound
+	}
+
+	rec.mu.Lock()
+	active := rec.game.Status == "active"
+	err := fn(rec)
+	ended := active && rec.game.Status != "active"
+	var snapshot *models.Game
+	if err == nil {
+		snapshot = rec.game.Clone()
+	}
+	rec.mu.Unlock()
+
+	// A rejected move may still end the game, e.g. on a flag fall
+	if ended {
+		gs.ended(gameID)
+	}
+	return snapshot, err
+}
+
+// AddEndHandler registers fn to be called with the ID of every game that
+// ends or is deleted, once the game's lock is released, so that state
+// kept for the game elsewhere can be dropped. Unlike the timeout handler,
+// any number of them may be added.
+func (gs *GameService) AddEndHandler(fn func(gameID string)) {
 	gs.mu.Lock()
-	gs.games[game.ID] = game
+	gs.onEnd = append(gs.onEnd, fn)
 	gs.mu.Unlock()
 }
 
+// ended runs the end handlers for gameID.
+func (gs *GameService) ended(gameID string) {
+	gs.mu.RLock()
+	handlers := gs.onEnd
+	gs.mu.RUnlock()
+	for _, fn := range handlers {
+		fn(gameID)
+	}
+}
+
 func (gs *GameService) MakeMove(gameID, playerID string, column int) (*models.Game, error) {
-	gs.mu.Lock()
-	game, exists := gs.games[gameID]
-	gs.mu.Unlock()
-	if !exists {
-		return nil, ErrGameNotFound
+	return gs.playTimed(gameID, playerID, func(game *models.Game, pos *engine.Position) error {
+		return applyDrop(game, pos, playerID, column)
+	})
+}
+
+// PopDisc removes the player's own disc from the bottom of column, letting
+// the rest of the column fall down one row. Only legal in PopOut games.
+func (gs *GameService) PopDisc(gameID, playerID string, column int) (*models.Game, error) {
+	return gs.playTimed(gameID, playerID, func(game *models.Game, pos *engine.Position) error {
+		return applyPop(game, pos, playerID, column)
+	})
+}
+
+// PlayMove applies a drop or pop move depending on its kind.
+func (gs *GameService) PlayMove(gameID, playerID string, move models.MovePayload) (*models.Game, error) {
+	switch move.Kind {
+	case "", models.MoveDrop:
+		return gs.MakeMove(gameID, playerID, move.Column)
+	case models.MovePop:
+		return gs.PopDisc(gameID, playerID, move.Column)
+	default:
+		return nil, ErrInvalidMoveKind
 	}
+}
+
+// RequestTakeback asks the opponent to let playerID take back their last
+// move. The request stays pending until answered or until a move is made.
+func (gs *GameService) RequestTakeback(gameID, playerID string) (*models.Game, error) {
+	return gs.update(gameID, func(game *models.Game, pos *engine.Position) error {
+		if game.Status != "active" {
+			return ErrGameNotActive
+		}
+		if playerID != game.Player1ID && playerID != game.Player2ID {
+			return ErrNotInGame
+		}
+		if game.TakebackRequestedBy != "" {
+			return ErrTakebackPending
+		}
+		if takebackPlies(game, playerID) == 0 {
+			return ErrNothingToTakeBack
+		}
+		game.TakebackRequestedBy = playerID
+		game.UpdatedAt = time.Now()
+		return nil
+	})
+}
+
+// RespondTakeback answers the opponent's pending takeback request. On
+// accept the game is rewound to just before the requester's last move.
+func (gs *GameService) RespondTakeback(gameID, playerID string, accept bool) (*models.Game, error) {
+	return gs.updateRecord(gameID, func(rec *gameRecord) error {
+		game := rec.game
+		requester := game.TakebackRequestedBy
+		if requester == "" {
+			return ErrNoTakebackRequest
+		}
+		if playerID != opponentOf(game, requester) {
+			return ErrNotTakebackResponder
+		}
+		game.TakebackRequestedBy = ""
+		game.UpdatedAt = time.Now()
+		if !accept {
+			return nil
+		}
+		// The player on move is charged for their time so far; the
+		// rewound position then starts the requester's clock afresh.
+		now := time.Now()
+		chargeTime(game, game.CurrentTurn, game.RemainingFor(game.CurrentTurn, now))
+		keep := len(game.Moves) - takebackPlies(game, requester)
+		if err := replay(game, rec.pos, game.Moves[:keep]); err != nil {
+			return err
+		}
+		gs.startClock(rec, now)
+		return nil
+	})
+}
+
+// Resign ends the game with a win for playerID's opponent.
+func (gs *GameService) Resign(gameID, playerID string) (*models.Game, error) {
+	return gs.updateRecord(gameID, func(rec *gameRecord) error {
+		game := rec.game
+		if game.Status != "active" {
+			return ErrGameNotActive
+		}
+		if playerID != game.Player1ID && playerID != game.Player2ID {
+			return ErrNotInGame
+		}
+		gs.endGame(rec, "resigned", opponentOf(game, playerID))
+		return nil
+	})
+}
+
+// OfferDraw offers the opponent a draw. The offer stays pending until
+// answered or until a move is made.
+func (gs *GameService) OfferDraw(gameID, playerID string) (*models.Game, error) {
+	return gs.update(gameID, func(game *models.Game, pos *engine.Position) error {
+		if game.Status != "active" {
+			return ErrGameNotActive
+		}
+		if playerID != game.Player1ID && playerID != game.Player2ID {
+			return ErrNotInGame
+		}
+		if game.DrawOfferedBy != "" {
+			return ErrDrawOfferPending
+		}
+		game.DrawOfferedBy = playerID
+		game.UpdatedAt = time.Now()
+		return nil
+	})
+}
+
+// RespondDraw answers the opponent's pending draw offer. Accepting ends the
+// game as an agreed draw.
+func (gs *GameService) RespondDraw(gameID, playerID string, accept bool) (*models.Game, error) {
+	return gs.updateRecord(gameID, func(rec *gameRecord) error {
+		game := rec.game
+		if game.Status != "active" {
+			return ErrGameNotActive
+		}
+		if game.DrawOfferedBy == "" {
+			return ErrNoDrawOffer
+		}
+		if playerID != opponentOf(game, game.DrawOfferedBy) {
+			return ErrNotDrawResponder
+		}
+		game.DrawOfferedBy = ""
+		game.UpdatedAt = time.Now()
+		if accept {
+			gs.endGame(rec, "agreed-draw", "")
+		}
+		return nil
+	})
+}
+
+// OfferRematch offers the opponent a rematch of a finished game.
+func (gs *GameService) OfferRematch(gameID, playerID string) (*models.Game, error) {
+	return gs.update(gameID, func(game *models.Game, pos *engine.Position) error {
+		if game.Status == "active" {
+			return ErrGameInProgress
+		}
+		if playerID != game.Player1ID && playerID != game.Player2ID {
+			return ErrNotInGame
+		}
+		if game.RematchID != "" {
+			return ErrRematchStarted
+		}
+		if game.RematchOfferedBy != "" {
+			return ErrRematchPending
+		}
+		game.RematchOfferedBy = playerID
+		game.UpdatedAt = time.Now()
+		return nil
+	})
+}
+
+// RespondRematch answers the opponent's pending rematch offer. Accepting
+// starts a new game between the same players with the same options, with
+// colors and first move swapped, and returns it as rematch.
+func (gs *GameService) RespondRematch(gameID, playerID string, accept bool) (game, rematch *models.Game, err error) {
+	game, err = gs.update(gameID, func(game *models.Game, pos *engine.Position) error {
+		if game.RematchOfferedBy == "" {
+			return ErrNoRematchOffer
+		}
+		if playerID != opponentOf(game, game.RematchOfferedBy) {
+			return ErrNotRematchResponder
+		}
+		game.RematchOfferedBy = ""
+		game.UpdatedAt = time.Now()
+		if accept {
+			game.RematchID = uuid.New().String()
+			rematch = newRematch(game)
+		}
+		return nil
+	})
+	if err != nil || rematch == nil {
+		return game, nil, err
+	}
+	rematch, err = gs.StoreGame(rematch)
+	return game, rematch, err
+}
+
+// newRematch builds the game with game.RematchID: the second player moves
+// first and the series score carries over.
+func newRematch(game *models.Game) *models.Game {
+	rematch := models.NewGame(game.RematchID, game.Player2ID, game.Player2Name, game.Player1ID, game.Player1Name, game.IsBot, game.Options())
+	rematch.Difficulty = game.Difficulty
+	rematch.Private = game.Private
+	rematch.Unrated = game.Unrated
+	rematch.Series = game.SeriesScore()
+	return rematch
+}
+
+// Forfeit ends the game as abandoned by playerID, who loses. It is used
+// when a disconnected player doesn't come back in time.
+func (gs *GameService) Forfeit(gameID, playerID string) (*models.Game, error) {
+	return gs.updateRecord(gameID, func(rec *gameRecord) error {
+		game := rec.game
+		if game.Status != "active" {
+			return ErrGameNotActive
+		}
+		if playerID != game.Player1ID && playerID != game.Player2ID {
+			return ErrNotInGame
+		}
+		gs.endGame(rec, "abandoned", opponentOf(game, playerID))
+		return nil
+	})
+}
+
+// HintPosition returns a snapshot of the game to compute playerID's hint
+// from, once it is clear that they may ask for one: only on their own turn
+// and while they have hints left. UseHint charges the hint once computed.
+func (gs *GameService) HintPosition(gameID, playerID string) (*models.Game, error) {
+	return gs.update(gameID, func(game *models.Game, pos *engine.Position) error {
+		return checkHint(game, playerID)
+	})
+}
+
+// UseHint charges playerID one hint. The game is checked again because it
+// may have ended while the hint was computed.
+func (gs *GameService) UseHint(gameID, playerID string) (*models.Game, error) {
+	return gs.update(gameID, func(game *models.Game, pos *engine.Position) error {
+		if err := checkHint(game, playerID); err != nil {
+			return err
+		}
+		if game.HintsUsed == nil {
+			game.HintsUsed = make(map[string]int)
+		}
+		game.HintsUsed[playerID]++
+		game.UpdatedAt = time.Now()
+		return nil
+	})
+}
+
+func checkHint(game *models.Game, playerID string) error {
 	if game.Status != "active" {
-		return nil, ErrGameNotActive
+		return ErrGameNotActive
+	}
+	if playerID != game.Player1ID && playerID != game.Player2ID {
+		return ErrNotInGame
 	}
 	if game.CurrentTurn != playerID {
-		return nil, ErrNotPlayersTurn
+		return ErrNotPlayersTurn
 	}
-	if column < 0 || column >= 7 {
-		return nil, ErrInvalidColumn
+	if game.HintsUsed[playerID] >= models.MaxHints {
+		return ErrNoHintsLeft
 	}
+	return nil
+}
+
+// AddChat stores a chat message with the game. Players may keep chatting
+// after the game ends.
+func (gs *GameService) AddChat(gameID string, msg models.ChatMessage) error {
+	_, err := gs.update(gameID, func(game *models.Game, pos *engine.Position) error {
+		game.Chat = append(game.Chat, msg)
+		return nil
+	})
+	return err
+}
 
-	// Find the lowest empty row in the specified column
-	row := -1
-	for r := 5; r >= 0; r-- {
-		if game.Board[r][column] == 0 {
-			row = r
-			break
+// endGame finishes an active game outside of normal play, freezing the
+// clocks and dropping any pending requests. Must be called with rec.mu
+// held.
+func (gs *GameService) endGame(rec *gameRecord, status, winner string) {
+	game := rec.game
+	now := time.Now()
+	chargeTime(game, game.CurrentTurn, game.RemainingFor(game.CurrentTurn, now))
+	game.Status = status
+	game.Winner = winner
+	game.TakebackRequestedBy = ""
+	game.DrawOfferedBy = ""
+	game.UpdatedAt = now
+	gs.startClock(rec, now)
+}
+
+// takebackPlies returns how many plies must be undone so that it is
+// playerID's turn again just before their last move: one if the opponent
+// has not replied yet, two if they have.
+func takebackPlies(game *models.Game, playerID string) int {
+	for i := len(game.Moves) - 1; i >= 0; i-- {
+		if game.Moves[i].PlayerID == playerID {
+			return len(game.Moves) - i
 		}
 	}
+	return 0
+}
 
-	if row == -1 {
-		return nil, ErrColumnFull
+// replay resets the game to its starting position and replays moves,
+// keeping their original timestamps.
+func replay(game *models.Game, pos *engine.Position, moves []models.Move) error {
+	history := make([]models.Move, len(moves))
+	copy(history, moves)
+
+	fresh, err := engine.New(game.Rows, game.Columns, game.WinLength)
+	if err != nil {
+		return err
 	}
+	*pos = *fresh
+	game.Board = models.NewBoard(game.Rows, game.Columns)
+	game.Moves = []models.Move{}
+	game.Status = "active"
+	game.Winner = ""
+	game.WinningLines = nil
+	game.WinningMove = nil
+	game.CurrentTurn = game.Player1ID
+	game.PositionCounts = nil
 
-	//place piece
-	piece := 1
-	if playerID == game.Player2ID {
-		piece = 2
+	payloads := make([]models.MovePayload, len(history))
+	for i, m := range history {
+		payloads[i] = models.MovePayload{Column: m.Column, Kind: m.Kind}
+	}
+	if err := playMoves(game, pos, payloads); err != nil {
+		return err
+	}
+	copy(game.Moves, history)
+	if game.WinningMove != nil {
+		last := game.Moves[len(game.Moves)-1]
+		game.WinningMove = &last
 	}
+	return nil
+}
+
+func applyDrop(game *models.Game, pos *engine.Position, playerID string, column int) error {
+	if game.Status != "active" {
+		return ErrGameNotActive
+	}
+	if game.CurrentTurn != playerID {
+		return ErrNotPlayersTurn
+	}
+	if column < 0 || column >= game.Columns {
+		return ErrInvalidColumn
+	}
+	if !pos.CanPlay(column) {
+		return ErrColumnFull
+	}
+
+	//place piece
+	piece := pieceFor(game, playerID)
+	row := pos.Play(column)
 	game.Board[row][column] = piece
 
-	if gs.checkWin(game.Board, piece) {
+	if pos.Winner() == piece {
 		game.Status = "won"
 		game.Winner = playerID
-	} else if gs.isBoardFull(game.Board) {
-		game.Status = "draw"
-	} else {
-		if game.CurrentTurn == game.Player1ID {
-			game.CurrentTurn = game.Player2ID
-		} else {
-			game.CurrentTurn = game.Player1ID
-		}
 	}
-	gs.mu.Lock()
-	gs.games[game.ID] = game
-	gs.mu.Unlock()
-	return game, nil
+	recordMove(game, playerID, models.MoveDrop, column)
+	recordWin(game, pos)
+	finishTurn(game, pos)
+	return nil
 }
 
-func (gs *GameService) checkWin(board [6][7]int, piece int) bool {
-	// Check horizontal, vertical, diagonal
-	for row := 0; row < 6; row++ {
-		for col := 0; col < 7; col++ {
-			if board[row][col] == piece {
-				if gs.checkDirection(board, row, col, piece, 0, 1) || // horizontal
-					gs.checkDirection(board, row, col, piece, 1, 0) || // vertical
-					gs.checkDirection(board, row, col, piece, 1, 1) || // diagonal right
-					gs.checkDirection(board, row, col, piece, 1, -1) { // diagonal left
-					return true
-				}
-			}
+func applyPop(game *models.Game, pos *engine.Position, playerID string, column int) error {
+	if game.Status != "active" {
+		return ErrGameNotActive
+	}
+	if game.Variant != models.VariantPopOut {
+		return ErrPopNotAllowed
+	}
+	if game.CurrentTurn != playerID {
+		return ErrNotPlayersTurn
+	}
+	if column < 0 || column >= game.Columns {
+		return ErrInvalidColumn
+	}
+	if !pos.CanPop(column) {
+		return ErrCannotPop
+	}
+
+	// A pop can complete lines for both players at once; the engine
+	// awards the popper the win if they have one.
+	pos.Pop(column)
+	game.Board = pos.Board()
+	switch pos.Winner() {
+	case pieceFor(game, playerID):
+		game.Status = "won"
+		game.Winner = playerID
+	case 3 - pieceFor(game, playerID):
+		game.Status = "won"
+		game.Winner = opponentOf(game, playerID)
+	}
+	recordMove(game, playerID, models.MovePop, column)
+	recordWin(game, pos)
+	finishTurn(game, pos)
+	return nil
+}
+
+// recordMove appends an accepted move to the game's history. Pending
+// takeback requests and draw offers lapse once another move is made.
+func recordMove(game *models.Game, playerID, kind string, column int) {
+	game.Moves = append(game.Moves, models.Move{
+		GameID:    game.ID,
+		PlayerID:  playerID,
+		Ply:       len(game.Moves) + 1,
+		Column:    column,
+		Kind:      kind,
+		CreatedAt: time.Now(),
+	})
+	game.TakebackRequestedBy = ""
+	game.DrawOfferedBy = ""
+}
+
+// recordWin stores the winner's lines and the move that completed them
+// once the last move has won the game.
+func recordWin(game *models.Game, pos *engine.Position) {
+	if game.Status != "won" {
+		return
+	}
+	game.WinningLines = nil
+	for _, line := range pos.Lines(pieceFor(game, game.Winner)) {
+		cells := make([]models.Cell, len(line))
+		for i, c := range line {
+			cells[i] = models.Cell{Row: c.Row, Column: c.Column}
 		}
+		game.WinningLines = append(game.WinningLines, cells)
 	}
-	return false
+	last := game.Moves[len(game.Moves)-1]
+	game.WinningMove = &last
 }
 
-func (gs *GameService) checkDirection(board [6][7]int, row, col int, piece int, dRow, dCol int) bool {
-	// count := 0
-	for i := 0; i < 4; i++ {
-		r := row + i*dRow
-		c := col + i*dCol
-		if r < 0 || r >= 6 || c < 0 || c >= 7 || board[r][c] != piece {
-			return false
+// finishTurn passes the turn to the opponent of an active game and settles
+// draws: the game is drawn when the next player has no legal move, or in
+// PopOut when the same position occurs for the third time.
+func finishTurn(game *models.Game, pos *engine.Position) {
+	game.UpdatedAt = time.Now()
+	if game.Status != "active" {
+		return
+	}
+	game.CurrentTurn = opponentOf(game, game.CurrentTurn)
+	if !hasLegalMove(pos, game.Variant) {
+		game.Status = "draw"
+	} else if game.Variant == models.VariantPopOut {
+		if game.PositionCounts == nil {
+			game.PositionCounts = make(map[uint64]int)
 		}
+		key := pos.Hash()
+		game.PositionCounts[key]++
+		if game.PositionCounts[key] >= 3 {
+			game.Status = "draw"
+		}
+	}
+}
+
+func pieceFor(game *models.Game, playerID string) int {
+	if playerID == game.Player2ID {
+		return 2
 	}
-	return true
+	return 1
 }
 
-func (gs *GameService) isBoardFull(board [6][7]int) bool {
-	for _, row := range board {
-		for _, cell := range row {
-			if cell == 0 {
-				return false
-			}
+func opponentOf(game *models.Game, playerID string) string {
+	if playerID == game.Player1ID {
+		return game.Player2ID
+	}
+	return game.Player1ID
+}
+
+// hasLegalMove reports whether the player to move can drop, or in PopOut
+// pop, anywhere.
+func hasLegalMove(pos *engine.Position, variant string) bool {
+	for col := 0; col < pos.Columns(); col++ {
+		if pos.CanPlay(col) {
+			return true
+		}
+		if variant == models.VariantPopOut && pos.CanPop(col) {
+			return true
 		}
 	}
-	return true
+	return false
 }
 
+// GetGame returns a snapshot of the game.
 func (gs *GameService) GetGame(gameID string) (*models.Game, error) {
+	return gs.update(gameID, func(*models.Game, *engine.Position) error { return nil })
+}
+
+// ActiveGames returns snapshots of the games in progress, oldest first.
+func (gs *GameService) ActiveGames() []*models.Game {
+	return gs.Games(func(game *models.Game) bool { return game.Status == "active" })
+}
+
+// Games returns snapshots of the games that match, oldest first. A nil
+// match returns every game.
+func (gs *GameService) Games(match func(game *models.Game) bool) []*models.Game {
 	gs.mu.RLock()
-	game, exists := gs.games[gameID]
+	recs := make([]*gameRecord, 0, len(gs.games))
+	for _, rec := range gs.games {
+		recs = append(recs, rec)
+	}
 	gs.mu.RUnlock()
-	if !exists {
-		return nil, fmt.Errorf("game not found")
+
+	var games []*models.Game
+	for _, rec := range recs {
+		rec.mu.Lock()
+		if match == nil || match(rec.game) {
+			games = append(games, rec.game.Clone())
+		}
+		rec.mu.Unlock()
+	}
+	sort.Slice(games, func(i, j int) bool { return games[i].CreatedAt.Before(games[j].CreatedAt) })
+	return games
+}
+
+// PlayerRecord tallies a player's results over the games the service
+// holds and finds the game they are playing, if any. ok is false if the
+// player is in none of the games.
+func (gs *GameService) PlayerRecord(playerID string) (player models.Player, activeGameID string, ok bool) {
+	games := gs.Games(func(game *models.Game) bool {
+		return game.Player1ID == playerID || game.Player2ID == playerID
+	})
+	if len(games) == 0 {
+		return models.Player{}, "", false
 	}
-	return game, nil
+	player.ID = playerID
+	for _, game := range games {
+		if game.Player1ID == playerID {
+			player.Username = game.Player1Name
+		} else {
+			player.Username = game.Player2Name
+		}
+		switch {
+		case game.Status == "active":
+			activeGameID = game.ID
+		case game.Winner == playerID:
+			player.Wins++
+		case game.Winner != "":
+			player.Losses++
+		default:
+			player.Draws++
+		}
+	}
+	return player, activeGameID, true
 }
 
 func (gs *GameService) DeleteGame(gameID string) {
 	gs.mu.Lock()
+	rec, exists := gs.games[gameID]
 	delete(gs.games, gameID)
 	gs.mu.Unlock()
+	if exists {
+		rec.mu.Lock()
+		gs.stopClock(rec)
+		rec.mu.Unlock()
+		gs.ended(gameID)
+	}
 }
@@ -0,0 +1,260 @@
+package services
+
+import (
+	"4-in-a-row/models"
+	"errors"
+	"fmt"
+	"math/rand"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+// TestConcurrentGames plays many games at once, people against people and
+// against the bot, while other goroutines read and resign games. Run it
+// with -race: it checks the per-game locking as much as the results.
+func TestConcurrentGames(t *testing.T) {
+	const games = 24
+	gs := NewGameService()
+	bot := NewBotService(gs, 0)
+
+	ids := make([]string, games)
+	for i := range ids {
+		p1, p2 := fmt.Sprintf("p%d-a", i), fmt.Sprintf("p%d-b", i)
+		isBot := i%2 == 1
+		if isBot {
+			p2 = "bot"
+		}
+		game := models.NewGame(fmt.Sprintf("game-%d", i), p1, p1, p2, p2, isBot, models.DefaultGameOptions())
+		if isBot {
+			game.Difficulty = models.DifficultyEasy
+		}
+		game, err := gs.StoreGame(game)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[i] = game.ID
+	}
+
+	var players, readers sync.WaitGroup
+	done := make(chan struct{})
+	for i, id := range ids {
+		game, _ := gs.GetGame(id)
+		for _, playerID := range []string{game.Player1ID, game.Player2ID} {
+			players.Add(1)
+			go func(playerID string, seed int64) {
+				defer players.Done()
+				play(t, gs, bot, id, playerID, rand.New(rand.NewSource(seed)))
+			}(playerID, int64(i))
+		}
+		if i%3 == 0 {
+			players.Add(1)
+			go func() {
+				defer players.Done()
+				resignAfter(t, gs, id, game.Player1ID, 6)
+			}()
+		}
+	}
+	for i := 0; i < 4; i++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				for _, id := range ids {
+					if _, err := gs.GetGame(id); err != nil {
+						t.Error(err)
+						return
+					}
+				}
+				gs.ActiveGames()
+				gs.PlayerRecord("p0-a")
+			}
+		}()
+	}
+	players.Wait()
+	close(done)
+	readers.Wait()
+
+	for _, id := range ids {
+		game, err := gs.GetGame(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if game.Status == "active" {
+			t.Errorf("game %s still active", id)
+		}
+		checkConsistent(t, game)
+	}
+}
+
+// play makes playerID's moves in the game until it ends: random legal
+// drops for people, and the bot's choice for the bot.
+func play(t *testing.T, gs *GameService, bot *BotService, gameID, playerID string, rng *rand.Rand) {
+	for {
+		game, err := gs.GetGame(gameID)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if game.Status != "active" {
+			return
+		}
+		if game.CurrentTurn != playerID {
+			runtime.Gosched()
+			continue
+		}
+		move := models.MovePayload{Column: rng.Intn(game.Columns), Kind: models.MoveDrop}
+		if playerID == "bot" {
+			move = bot.MakeBotMove(game)
+		}
+		_, err = gs.PlayMove(gameID, playerID, move)
+		switch {
+		case err == nil, errors.Is(err, ErrColumnFull):
+		case errors.Is(err, ErrGameNotActive):
+			// resigned meanwhile
+			return
+		default:
+			t.Errorf("%s in %s: %v", playerID, gameID, err)
+			return
+		}
+	}
+}
+
+// resignAfter resigns for playerID once the game has reached plies moves,
+// racing the moves still being played.
+func resignAfter(t *testing.T, gs *GameService, gameID, playerID string, plies int) {
+	for {
+		game, err := gs.GetGame(gameID)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if game.Status != "active" {
+			return
+		}
+		if len(game.Moves) < plies {
+			runtime.Gosched()
+			continue
+		}
+		if _, err := gs.Resign(gameID, playerID); err != nil && !errors.Is(err, ErrGameNotActive) {
+			t.Error(err)
+		}
+		return
+	}
+}
+
+// checkConsistent checks that a finished game's board, moves and result
+// agree with each other.
+func checkConsistent(t *testing.T, game *models.Game) {
+	t.Helper()
+	discs := 0
+	for _, row := range game.Board {
+		for _, cell := range row {
+			if cell != 0 {
+				discs++
+			}
+		}
+	}
+	if discs != len(game.Moves) {
+		t.Errorf("game %s: %d discs on the board, %d moves", game.ID, discs, len(game.Moves))
+	}
+	for i, move := range game.Moves {
+		want := game.Player1ID
+		if i%2 == 1 {
+			want = game.Player2ID
+		}
+		if move.PlayerID != want {
+			t.Errorf("game %s: move %d by %s, want %s", game.ID, i, move.PlayerID, want)
+			break
+		}
+	}
+	switch game.Status {
+	case "won", "resigned":
+		if game.Winner != game.Player1ID && game.Winner != game.Player2ID {
+			t.Errorf("game %s: %s with winner %q", game.ID, game.Status, game.Winner)
+		}
+	case "draw":
+		if game.Winner != "" {
+			t.Errorf("game %s: draw with winner %q", game.ID, game.Winner)
+		}
+	default:
+		t.Errorf("game %s: unexpected status %q", game.ID, game.Status)
+	}
+}
+
+// TestConcurrentMovesSameTurn races one player's moves on the same turn:
+// exactly one of them may be played.
+func TestConcurrentMovesSameTurn(t *testing.T) {
+	gs := NewGameService()
+	game, err := gs.CreateGame("a", "a", "b", "b", false, models.GameOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const tries = 16
+	var wg sync.WaitGroup
+	errs := make(chan error, tries)
+	for i := 0; i < tries; i++ {
+		wg.Add(1)
+		go func(column int) {
+			defer wg.Done()
+			_, err := gs.PlayMove(game.ID, "a", models.MovePayload{Column: column})
+			errs <- err
+		}(i % game.Columns)
+	}
+	wg.Wait()
+	close(errs)
+
+	played := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			played++
+		case !errors.Is(err, ErrNotPlayersTurn):
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if played != 1 {
+		t.Errorf("%d moves played, want 1", played)
+	}
+	game, _ = gs.GetGame(game.ID)
+	if len(game.Moves) != 1 || game.CurrentTurn != "b" {
+		t.Errorf("after the race: %d moves, %s to move", len(game.Moves), game.CurrentTurn)
+	}
+}
+
+// TestHintCharging checks that looking up a hint's position is free and
+// that only UseHint counts against the player's hints.
+func TestHintCharging(t *testing.T) {
+	gs := NewGameService()
+	game, err := gs.CreateGame("a", "a", "b", "b", false, models.GameOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gs.HintPosition(game.ID, "b"); !errors.Is(err, ErrNotPlayersTurn) {
+		t.Errorf("HintPosition off turn: %v, want ErrNotPlayersTurn", err)
+	}
+	for i := 0; i < models.MaxHints; i++ {
+		if _, err := gs.HintPosition(game.ID, "a"); err != nil {
+			t.Fatal(err)
+		}
+		game, err = gs.UseHint(game.ID, "a")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if game.HintsUsed["a"] != models.MaxHints {
+		t.Errorf("%d hints used, want %d", game.HintsUsed["a"], models.MaxHints)
+	}
+	if _, err := gs.HintPosition(game.ID, "a"); !errors.Is(err, ErrNoHintsLeft) {
+		t.Errorf("HintPosition: %v, want ErrNoHintsLeft", err)
+	}
+	if _, err := gs.UseHint(game.ID, "a"); !errors.Is(err, ErrNoHintsLeft) {
+		t.Errorf("UseHint: %v, want ErrNoHintsLeft", err)
+	}
+}
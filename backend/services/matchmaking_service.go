@@ -9,10 +9,12 @@ import (
 )
 
 type WaitingPlayer struct {
-	ID        string
-	Name      string
-	Timestamp time.Time
-	Channel   chan *models.Game
+	ID         string
+	Name       string
+	Options    models.GameOptions
+	Difficulty string
+	Timestamp  time.Time
+	Channel    chan *models.Game
 }
 
 type MatchmakingService struct {
@@ -30,36 +32,34 @@ func NewMatchmakingService(timeout int) *MatchmakingService {
 	return ms
 }
 
-func (ms *MatchmakingService) AddPlayer(playerID, playerName string) *models.Game {
+// AddPlayer pairs the player with someone waiting for a game with the same
+// options, or falls back to a bot game at the given difficulty after the
+// matchmaking timeout. opts and difficulty must already be normalized.
+func (ms *MatchmakingService) AddPlayer(playerID, playerName string, opts models.GameOptions, difficulty string) *models.Game {
 	ms.mu.Lock()
 	var match *WaitingPlayer
 	for _, wp := range ms.WaitingPlayers {
-		match = wp
-		break
+		if wp.Options == opts {
+			match = wp
+			break
+		}
 	}
 	if match != nil {
 		delete(ms.WaitingPlayers, match.ID)
 		ms.mu.Unlock()
 
-		game := &models.Game{
-			ID:          uuid.New().String(),
-			Player1ID:   match.ID,
-			Player1Name: match.Name,
-			Player2ID:   playerID,
-			Player2Name: playerName,
-			CurrentTurn: match.ID,
-			Status:      "active",
-			IsBot:       false,
-		}
+		game := models.NewGame(uuid.New().String(), match.ID, match.Name, playerID, playerName, false, opts)
 		match.Channel <- game
 		return game
 	}
 
 	wp := &WaitingPlayer{
-		ID:        playerID,
-		Name:      playerName,
-		Timestamp: time.Now(),
-		Channel:   make(chan *models.Game),
+		ID:         playerID,
+		Name:       playerName,
+		Options:    opts,
+		Difficulty: difficulty,
+		Timestamp:  time.Now(),
+		Channel:    make(chan *models.Game),
 	}
 	ms.WaitingPlayers[playerID] = wp
 	ms.mu.Unlock()
@@ -72,16 +72,8 @@ func (ms *MatchmakingService) AddPlayer(playerID, playerName string) *models.Gam
 		ms.mu.Lock()
 		delete(ms.WaitingPlayers, playerID)
 		ms.mu.Unlock()
-		game := &models.Game{
-			ID:          uuid.New().String(),
-			Player1ID:   playerID,
-			Player1Name: playerName,
-			Player2ID:   "bot",
-			Player2Name: "Bot",
-			CurrentTurn: playerID,
-			Status:      "active",
-			IsBot:       true,
-		}
+		game := models.NewGame(uuid.New().String(), playerID, playerName, "bot", "Bot", true, opts)
+		game.Difficulty = difficulty
 		return game
 	}
 }
@@ -104,4 +96,16 @@ func (ms *MatchmakingService) RemovePlayer(playerID string) {
 	ms.mu.Lock()
 	delete(ms.WaitingPlayers, playerID)
 	ms.mu.Unlock()
-}
\ No newline at end of file
+}
+
+// Waiting returns the name of a player in the matchmaking queue, and
+// whether they are in it.
+func (ms *MatchmakingService) Waiting(playerID string) (name string, ok bool) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	wp, ok := ms.WaitingPlayers[playerID]
+	if !ok {
+		return "", false
+	}
+	return wp.Name, true
+}
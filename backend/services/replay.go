@@ -0,0 +1,105 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"4-in-a-row/engine"
+	"4-in-a-row/models"
+	"4-in-a-row/notation"
+
+	"github.com/google/uuid"
+)
+
+var ErrResultMismatch = errors.New("recorded result does not match the moves")
+
+// ReplayGame builds a new game between the given players by replaying
+// moves from the empty board, checking each one against the rules. The
+// game is not stored; pass it to GameService.StoreGame to play on from
+// there.
+func ReplayGame(player1ID, player1Name, player2ID, player2Name string, opts models.GameOptions, moves []models.MovePayload) (*models.Game, error) {
+	opts, err := opts.Normalize()
+	if err != nil {
+		return nil, err
+	}
+	opts.TimeControl = models.TimeControl{}
+	game := models.NewGame(uuid.New().String(), player1ID, player1Name, player2ID, player2Name, false, opts)
+	pos, err := engine.New(opts.Rows, opts.Columns, opts.WinLength)
+	if err != nil {
+		return nil, err
+	}
+	if err := playMoves(game, pos, moves); err != nil {
+		return nil, err
+	}
+	return game, nil
+}
+
+// playMoves applies moves in order, each for the player to move, checking
+// them against the rules as it goes.
+func playMoves(game *models.Game, pos *engine.Position, moves []models.MovePayload) error {
+	for i, m := range moves {
+		var err error
+		if m.Kind == models.MovePop {
+			err = applyPop(game, pos, game.CurrentTurn, m.Column)
+		} else {
+			err = applyDrop(game, pos, game.CurrentTurn, m.Column)
+		}
+		if err != nil {
+			return fmt.Errorf("ply %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// ImportRecord replays a game read from notation and applies its recorded
+// result. Games that ended by resignation, agreement or time are given
+// that final status; for all others the result must follow from the moves.
+func ImportRecord(r *notation.Record) (*models.Game, error) {
+	player1ID, player2ID := r.Player1, r.Player2
+	if player1ID == "" {
+		player1ID = "player1"
+	}
+	if player2ID == "" {
+		player2ID = "player2"
+	}
+	if player1ID == player2ID {
+		player2ID += "_2"
+	}
+
+	game, err := ReplayGame(player1ID, r.Player1, player2ID, r.Player2, r.Options, r.Moves)
+	if err != nil {
+		return nil, err
+	}
+	if !r.Date.IsZero() {
+		game.CreatedAt = r.Date
+	}
+
+	result := r.Result
+	if result == "" {
+		result = notation.ResultOngoing
+	}
+	if game.Status != "active" || result == notation.ResultOngoing {
+		if notation.ResultOf(game) != result {
+			return nil, ErrResultMismatch
+		}
+		return game, nil
+	}
+
+	status := notation.StatusOf(r.Termination)
+	switch {
+	case status == "" && result == notation.ResultDraw:
+		status = "agreed-draw"
+	case status == "":
+		status = "resigned"
+	case (status == "agreed-draw") != (result == notation.ResultDraw):
+		return nil, ErrResultMismatch
+	}
+	game.Status = status
+	switch result {
+	case notation.ResultPlayer1:
+		game.Winner = game.Player1ID
+	case notation.ResultPlayer2:
+		game.Winner = game.Player2ID
+	}
+	return game, nil
+}
@@ -0,0 +1,106 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"4-in-a-row/models"
+	"4-in-a-row/notation"
+)
+
+// TestImportRoundTrip exports games played on the service and imports
+// them again.
+func TestImportRoundTrip(t *testing.T) {
+	gs := NewGameService()
+
+	// PopOut: bob wins after alice pops her own disc
+	game, err := gs.CreateGame("a", "alice", "b", "bob", false, models.GameOptions{Variant: models.VariantPopOut})
+	if err != nil {
+		t.Fatal(err)
+	}
+	moves := []struct {
+		player string
+		move   models.MovePayload
+	}{
+		{"a", models.MovePayload{Column: 0}}, {"b", models.MovePayload{Column: 1}},
+		{"a", models.MovePayload{Column: 0}}, {"b", models.MovePayload{Column: 1}},
+		{"a", models.MovePayload{Column: 0}}, {"b", models.MovePayload{Column: 1}},
+		{"a", models.MovePayload{Column: 0, Kind: models.MovePop}}, {"b", models.MovePayload{Column: 1}},
+	}
+	for _, m := range moves {
+		if game, err = gs.PlayMove(game.ID, m.player, m.move); err != nil {
+			t.Fatal(err)
+		}
+	}
+	popOut := game
+
+	// standard: alice resigns
+	game, err = gs.CreateGame("a", "alice", "b", "bob", false, models.GameOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gs.PlayMove(game.ID, "a", models.MovePayload{Column: 3})
+	gs.PlayMove(game.ID, "b", models.MovePayload{Column: 3})
+	resigned, err := gs.Resign(game.ID, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, game := range []*models.Game{popOut, resigned} {
+		text := notation.FromGame(game).String()
+		r, err := notation.ParsePGN(text)
+		if err != nil {
+			t.Fatalf("ParsePGN(%q): %v", text, err)
+		}
+		imported, err := ImportRecord(r)
+		if err != nil {
+			t.Fatalf("ImportRecord(%q): %v", text, err)
+		}
+		if imported.Status != game.Status || notation.ResultOf(imported) != notation.ResultOf(game) {
+			t.Errorf("%s: imported %s %s, want %s %s", game.Variant, imported.Status,
+				notation.ResultOf(imported), game.Status, notation.ResultOf(game))
+		}
+		if !reflect.DeepEqual(imported.Board, game.Board) {
+			t.Errorf("%s: imported board %v, want %v", game.Variant, imported.Board, game.Board)
+		}
+		if notation.FormatMoves(imported.Moves) != notation.FormatMoves(game.Moves) {
+			t.Errorf("%s: imported moves %s, want %s", game.Variant,
+				notation.FormatMoves(imported.Moves), notation.FormatMoves(game.Moves))
+		}
+	}
+}
+
+func TestReplayGameIllegal(t *testing.T) {
+	tests := []struct {
+		moves   string
+		variant string
+		want    error
+	}{
+		{"1111111", models.VariantStandard, ErrColumnFull},
+		{"1p1", models.VariantStandard, ErrPopNotAllowed},
+		{"12p2", models.VariantPopOut, ErrCannotPop},
+		{"12121212", models.VariantStandard, ErrGameNotActive},
+	}
+	for _, tt := range tests {
+		moves, err := notation.ParseMoves(tt.moves, models.DefaultColumns)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = ReplayGame("a", "alice", "b", "bob", models.GameOptions{Variant: tt.variant}, moves)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: %v, want %v", tt.moves, err, tt.want)
+		}
+	}
+}
+
+func TestImportRecordMismatch(t *testing.T) {
+	// alice completes a line, but the record says bob won
+	r, err := notation.ParsePGN("[Result \"0-1\"]\n\n1. 1 2 2. 1 2 3. 1 2 4. 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ImportRecord(r); !errors.Is(err, ErrResultMismatch) {
+		t.Errorf("ImportRecord: %v, want ErrResultMismatch", err)
+	}
+}
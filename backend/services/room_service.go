@@ -0,0 +1,140 @@
+package services
+
+import (
+	"4-in-a-row/models"
+	"crypto/rand"
+	"errors"
+	"math/big"
+	mathrand "math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrRoomNotFound = errors.New("no open room with that code")
+	ErrRoomExpired  = errors.New("room expired before anyone joined")
+)
+
+// Room codes are read aloud and typed in, so they leave out letters and
+// digits that are easy to confuse (0/O, 1/I).
+const (
+	roomCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	roomCodeLength   = 6
+)
+
+// Room is a private room waiting for the host's opponent.
+type Room struct {
+	Code      string
+	HostID    string
+	HostName  string
+	Options   models.RoomOptions
+	ExpiresAt time.Time
+	// Channel receives the game when someone joins. It is buffered, so
+	// that joining never waits for the host.
+	Channel chan *models.Game
+	closed  chan struct{}
+}
+
+// Closed is closed when the room is closed without anyone joining.
+func (r *Room) Closed() <-chan struct{} { return r.closed }
+
+// RoomService keeps the open private rooms. Unlike matchmaking, a room
+// only ever starts a game with the player who joins it by code, never
+// with the bot.
+type RoomService struct {
+	rooms map[string]*Room
+	ttl   time.Duration
+	mu    sync.Mutex
+}
+
+func NewRoomService(ttl time.Duration) *RoomService {
+	return &RoomService{
+		rooms: make(map[string]*Room),
+		ttl:   ttl,
+	}
+}
+
+// Create opens a room for the host with opts, which must already be
+// normalized.
+func (rs *RoomService) Create(hostID, hostName string, opts models.RoomOptions) *Room {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	code := newRoomCode()
+	for rs.rooms[code] != nil {
+		code = newRoomCode()
+	}
+	room := &Room{
+		Code:      code,
+		HostID:    hostID,
+		HostName:  hostName,
+		Options:   opts,
+		ExpiresAt: time.Now().Add(rs.ttl),
+		Channel:   make(chan *models.Game, 1),
+		closed:    make(chan struct{}),
+	}
+	rs.rooms[code] = room
+	return room
+}
+
+// Join closes the room with code and starts its game between the host and
+// the guest. The host receives the game on the room's channel.
+func (rs *RoomService) Join(code, guestID, guestName string) (*models.Game, error) {
+	code = NormalizeRoomCode(code)
+	rs.mu.Lock()
+	room := rs.rooms[code]
+	if room == nil || time.Now().After(room.ExpiresAt) {
+		rs.mu.Unlock()
+		return nil, ErrRoomNotFound
+	}
+	delete(rs.rooms, code)
+	rs.mu.Unlock()
+
+	hostFirst := room.Options.FirstMove == models.FirstMoveHost ||
+		(room.Options.FirstMove == models.FirstMoveRandom && mathrand.Intn(2) == 0)
+	var game *models.Game
+	if hostFirst {
+		game = models.NewGame(uuid.New().String(), room.HostID, room.HostName, guestID, guestName, false, room.Options.GameOptions)
+	} else {
+		game = models.NewGame(uuid.New().String(), guestID, guestName, room.HostID, room.HostName, false, room.Options.GameOptions)
+	}
+	game.Private = true
+	game.Unrated = room.Options.Unrated
+	room.Channel <- game
+	return game, nil
+}
+
+// Close removes the room unless someone already joined it or it was
+// closed before. It reports whether the room was still open.
+func (rs *RoomService) Close(room *Room) bool {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if rs.rooms[room.Code] != room {
+		return false
+	}
+	delete(rs.rooms, room.Code)
+	close(room.closed)
+	return true
+}
+
+// NormalizeRoomCode upper-cases a code as typed and drops spaces and
+// dashes.
+func NormalizeRoomCode(code string) string {
+	code = strings.ToUpper(code)
+	return strings.NewReplacer(" ", "", "-", "").Replace(code)
+}
+
+func newRoomCode() string {
+	b := make([]byte, roomCodeLength)
+	max := big.NewInt(int64(len(roomCodeAlphabet)))
+	for i := range b {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			panic(err)
+		}
+		b[i] = roomCodeAlphabet[n.Int64()]
+	}
+	return string(b)
+}
@@ -0,0 +1,224 @@
+package services
+
+import (
+	"4-in-a-row/models"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// storeBoard stores a game between "a" (player 1) and "b" set up with the
+// board given as rows of '.', '1' and '2', top row first, and toMove to
+// play.
+func storeBoard(t *testing.T, gs *GameService, variant string, winLength int, toMove string, rows ...string) string {
+	t.Helper()
+	opts := models.GameOptions{Rows: len(rows), Columns: len(rows[0]), WinLength: winLength, Variant: variant}
+	game := models.NewGame(fmt.Sprintf("game-%d", len(gs.Games(nil))), "a", "a", "b", "b", false, opts)
+	for r, row := range rows {
+		for c, ch := range row {
+			if ch != '.' {
+				game.Board[r][c] = int(ch - '0')
+			}
+		}
+	}
+	game.CurrentTurn = toMove
+	stored, err := gs.StoreGame(game)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stored.ID
+}
+
+// TestMoveOutcomes sets up positions and checks how one more move ends, or
+// does not end, the game.
+func TestMoveOutcomes(t *testing.T) {
+	tests := []struct {
+		name    string
+		variant string
+		board   []string
+		move    models.MovePayload
+		status  string
+		winner  string
+		lines   int
+	}{
+		{
+			name:    "drop completes a line",
+			variant: models.VariantStandard,
+			board: []string{
+				".......",
+				".......",
+				".......",
+				".......",
+				"2......",
+				"2111.22",
+			},
+			move:   models.MovePayload{Column: 4, Kind: models.MoveDrop},
+			status: "won", winner: "a", lines: 1,
+		},
+		{
+			name:    "pop completes the popper's line",
+			variant: models.VariantPopOut,
+			board: []string{
+				".......",
+				".......",
+				".......",
+				"...1..2",
+				"1112..2",
+				"2211..2",
+			},
+			move:   models.MovePayload{Column: 3, Kind: models.MovePop},
+			status: "won", winner: "a", lines: 1,
+		},
+		{
+			name:    "pop completes only the opponent's line",
+			variant: models.VariantPopOut,
+			board: []string{
+				".......",
+				".......",
+				".......",
+				".......",
+				"1212...",
+				"2221.11",
+			},
+			move:   models.MovePayload{Column: 3, Kind: models.MovePop},
+			status: "won", winner: "b", lines: 1,
+		},
+		{
+			name:    "pop completes lines for both players",
+			variant: models.VariantPopOut,
+			board: []string{
+				".......",
+				".......",
+				".......",
+				"...1...",
+				"1112...",
+				"2221..2",
+			},
+			move:   models.MovePayload{Column: 3, Kind: models.MovePop},
+			status: "won", winner: "a", lines: 1,
+		},
+		{
+			name:    "last drop fills the board",
+			variant: models.VariantStandard,
+			board: []string{
+				"221.",
+				"1122",
+				"2211",
+				"1122",
+			},
+			move:   models.MovePayload{Column: 3},
+			status: "draw",
+		},
+		{
+			name:    "full PopOut board with pops left",
+			variant: models.VariantPopOut,
+			board: []string{
+				"221.",
+				"1122",
+				"2211",
+				"1122",
+			},
+			move:   models.MovePayload{Column: 3},
+			status: "active",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gs := NewGameService()
+			id := storeBoard(t, gs, tt.variant, 4, "a", tt.board...)
+			game, err := gs.PlayMove(id, "a", tt.move)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if game.Status != tt.status || game.Winner != tt.winner {
+				t.Errorf("status %s, winner %q; want %s, %q", game.Status, game.Winner, tt.status, tt.winner)
+			}
+			if len(game.WinningLines) != tt.lines {
+				t.Errorf("%d winning lines, want %d", len(game.WinningLines), tt.lines)
+			}
+			if tt.lines > 0 {
+				for _, cell := range game.WinningLines[0] {
+					if got := game.Board[cell.Row][cell.Column]; got != pieceFor(game, tt.winner) {
+						t.Errorf("winning line cell %+v holds %d", cell, got)
+					}
+				}
+				if game.WinningMove == nil || game.WinningMove.Column != tt.move.Column || game.WinningMove.Kind != tt.move.Kind {
+					t.Errorf("winning move %+v, want %+v", game.WinningMove, tt.move)
+				}
+			}
+		})
+	}
+}
+
+func TestIllegalPops(t *testing.T) {
+	board := []string{
+		"....",
+		"....",
+		"1...",
+		"21.2",
+	}
+	tests := []struct {
+		name    string
+		variant string
+		column  int
+		err     error
+	}{
+		{"standard game", models.VariantStandard, 1, ErrPopNotAllowed},
+		{"opponent's disc", models.VariantPopOut, 0, ErrCannotPop},
+		{"opponent's disc alone", models.VariantPopOut, 3, ErrCannotPop},
+		{"empty column", models.VariantPopOut, 2, ErrCannotPop},
+		{"off the board", models.VariantPopOut, 4, ErrInvalidColumn},
+	}
+	for _, tt := range tests {
+		gs := NewGameService()
+		id := storeBoard(t, gs, tt.variant, 4, "a", board...)
+		if _, err := gs.PlayMove(id, "a", models.MovePayload{Column: tt.column, Kind: models.MovePop}); !errors.Is(err, tt.err) {
+			t.Errorf("%s: %v, want %v", tt.name, err, tt.err)
+		}
+	}
+
+	// Popping an own disc lets the column fall
+	gs := NewGameService()
+	id := storeBoard(t, gs, models.VariantPopOut, 4, "b", board...)
+	game, err := gs.PlayMove(id, "b", models.MovePayload{Column: 0, Kind: models.MovePop})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if game.Board[3][0] != 1 || game.Board[2][0] != 0 || game.CurrentTurn != "a" {
+		t.Errorf("after the pop: column 0 holds %d under %d, %s to move", game.Board[3][0], game.Board[2][0], game.CurrentTurn)
+	}
+}
+
+// TestThreefoldRepetition drops and pops the same two discs over and
+// over. The position after the first drop comes back at plies 5 and 9,
+// which draws the game.
+func TestThreefoldRepetition(t *testing.T) {
+	cycle := []struct {
+		player string
+		move   models.MovePayload
+	}{
+		{"a", models.MovePayload{Column: 0}},
+		{"b", models.MovePayload{Column: 1}},
+		{"a", models.MovePayload{Column: 0, Kind: models.MovePop}},
+		{"b", models.MovePayload{Column: 1, Kind: models.MovePop}},
+	}
+	gs := NewGameService()
+	game, _ := gs.CreateGame("a", "a", "b", "b", false, models.GameOptions{Variant: models.VariantPopOut})
+	for ply := 1; ply <= 9; ply++ {
+		m := cycle[(ply-1)%len(cycle)]
+		var err error
+		if game, err = gs.PlayMove(game.ID, m.player, m.move); err != nil {
+			t.Fatalf("ply %d: %v", ply, err)
+		}
+		want := "active"
+		if ply == 9 {
+			want = "draw"
+		}
+		if game.Status != want || game.Winner != "" {
+			t.Fatalf("ply %d: status %s, winner %q; want %s", ply, game.Status, game.Winner, want)
+		}
+	}
+	if _, err := gs.PlayMove(game.ID, "b", models.MovePayload{Column: 1}); !errors.Is(err, ErrGameNotActive) {
+		t.Errorf("move after the draw: %v, want ErrGameNotActive", err)
+	}
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrInvalidResumeToken = errors.New("invalid or expired resume token")
+
+// session ties a player to their game so that a new connection can take
+// over after the old one drops.
+type session struct {
+	token    string
+	playerID string
+	gameID   string
+	timer    *time.Timer // forfeit timer while disconnected
+}
+
+// SessionService issues resume tokens and forfeits players who stay
+// disconnected for longer than the grace period.
+type SessionService struct {
+	byToken  map[string]*session
+	byPlayer map[string]*session
+	grace    time.Duration
+	onExpire func(playerID, gameID string)
+	mu       sync.Mutex
+}
+
+func NewSessionService(grace time.Duration) *SessionService {
+	return &SessionService{
+		byToken:  make(map[string]*session),
+		byPlayer: make(map[string]*session),
+		grace:    grace,
+	}
+}
+
+// Grace returns how long a disconnected player has to come back.
+func (ss *SessionService) Grace() time.Duration { return ss.grace }
+
+// SetExpireHandler registers fn to be called, on its own goroutine, when
+// a disconnected player's grace period runs out.
+func (ss *SessionService) SetExpireHandler(fn func(playerID, gameID string)) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.onExpire = fn
+}
+
+// Create starts a session for playerID in gameID and returns its resume
+// token, replacing any earlier session of the player.
+func (ss *SessionService) Create(playerID, gameID string) string {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.remove(playerID)
+	s := &session{token: uuid.NewString(), playerID: playerID, gameID: gameID}
+	ss.byToken[s.token] = s
+	ss.byPlayer[playerID] = s
+	return s.token
+}
+
+// Resume returns the player and game for token and cancels a pending
+// forfeit.
+func (ss *SessionService) Resume(token string) (playerID, gameID string, err error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	s := ss.byToken[token]
+	if s == nil {
+		return "", "", ErrInvalidResumeToken
+	}
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	return s.playerID, s.gameID, nil
+}
+
+// Lookup returns the player and game for token without touching the
+// session, for requests that authenticate with it.
+func (ss *SessionService) Lookup(token string) (playerID, gameID string, err error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	s := ss.byToken[token]
+	if s == nil {
+		return "", "", ErrInvalidResumeToken
+	}
+	return s.playerID, s.gameID, nil
+}
+
+// Disconnect starts the player's grace period.
+func (ss *SessionService) Disconnect(playerID string) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	s := ss.byPlayer[playerID]
+	if s == nil || s.timer != nil {
+		return
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(ss.grace, func() {
+		ss.mu.Lock()
+		// a Resume or Remove in the meantime replaces or clears the timer
+		if s.timer != timer {
+			ss.mu.Unlock()
+			return
+		}
+		ss.remove(playerID)
+		onExpire := ss.onExpire
+		ss.mu.Unlock()
+		if onExpire != nil {
+			onExpire(s.playerID, s.gameID)
+		}
+	})
+	s.timer = timer
+}
+
+// Remove ends the player's session, e.g. once their game is over.
+func (ss *SessionService) Remove(playerID string) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.remove(playerID)
+}
+
+func (ss *SessionService) remove(playerID string) {
+	s := ss.byPlayer[playerID]
+	if s == nil {
+		return
+	}
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	delete(ss.byPlayer, playerID)
+	delete(ss.byToken, s.token)
+}
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSessionTokens(t *testing.T) {
+	ss := NewSessionService(time.Minute)
+	token := ss.Create("a", "g1")
+	if playerID, gameID, err := ss.Lookup(token); err != nil || playerID != "a" || gameID != "g1" {
+		t.Fatalf("Lookup = %s, %s, %v; want a, g1", playerID, gameID, err)
+	}
+	if _, _, err := ss.Lookup("nonsense"); !errors.Is(err, ErrInvalidResumeToken) {
+		t.Errorf("Lookup of an unknown token: %v, want ErrInvalidResumeToken", err)
+	}
+
+	// A new game replaces the player's session and its token
+	next := ss.Create("a", "g2")
+	if next == token {
+		t.Fatal("same token for a new session")
+	}
+	if _, _, err := ss.Resume(token); !errors.Is(err, ErrInvalidResumeToken) {
+		t.Errorf("Resume with the replaced token: %v, want ErrInvalidResumeToken", err)
+	}
+	if playerID, gameID, err := ss.Resume(next); err != nil || playerID != "a" || gameID != "g2" {
+		t.Errorf("Resume = %s, %s, %v; want a, g2", playerID, gameID, err)
+	}
+
+	ss.Remove("a")
+	if _, _, err := ss.Lookup(next); !errors.Is(err, ErrInvalidResumeToken) {
+		t.Errorf("Lookup after Remove: %v, want ErrInvalidResumeToken", err)
+	}
+}
+
+func TestSessionGrace(t *testing.T) {
+	const grace = 50 * time.Millisecond
+	ss := NewSessionService(grace)
+	type expiry struct{ playerID, gameID string }
+	expired := make(chan expiry, 2)
+	ss.SetExpireHandler(func(playerID, gameID string) { expired <- expiry{playerID, gameID} })
+
+	// Resuming in time cancels the forfeit, and so does Remove
+	resumed := ss.Create("a", "g1")
+	ss.Disconnect("a")
+	if _, _, err := ss.Resume(resumed); err != nil {
+		t.Fatal(err)
+	}
+	ss.Create("b", "g2")
+	ss.Disconnect("b")
+	ss.Remove("b")
+	select {
+	case e := <-expired:
+		t.Fatalf("%s forfeited after reconnecting or leaving", e.playerID)
+	case <-time.After(4 * grace):
+	}
+	if _, _, err := ss.Lookup(resumed); err != nil {
+		t.Errorf("session lost after resuming: %v", err)
+	}
+
+	// Staying away forfeits
+	start := time.Now()
+	ss.Disconnect("a")
+	select {
+	case e := <-expired:
+		if e != (expiry{"a", "g1"}) {
+			t.Errorf("expired %+v, want a in g1", e)
+		}
+		if waited := time.Since(start); waited < grace {
+			t.Errorf("forfeit after %v, before the grace period of %v", waited, grace)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no forfeit after the grace period")
+	}
+	if _, _, err := ss.Resume(resumed); !errors.Is(err, ErrInvalidResumeToken) {
+		t.Errorf("Resume after the forfeit: %v, want ErrInvalidResumeToken", err)
+	}
+}
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"4-in-a-row/models"
+	"errors"
+	"testing"
+)
+
+// playMovesOn plays moves on a stored game, each by the player to move.
+func playMovesOn(t *testing.T, gs *GameService, gameID string, moves ...models.MovePayload) *models.Game {
+	t.Helper()
+	game, err := gs.GetGame(gameID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range moves {
+		if game, err = gs.PlayMove(gameID, game.CurrentTurn, m); err != nil {
+			t.Fatalf("%s plays %+v: %v", game.CurrentTurn, m, err)
+		}
+	}
+	return game
+}
+
+func drops(columns ...int) []models.MovePayload {
+	moves := make([]models.MovePayload, len(columns))
+	for i, c := range columns {
+		moves[i] = models.MovePayload{Column: c}
+	}
+	return moves
+}
+
+// takeBack has playerID request a takeback and the opponent accept it.
+func takeBack(t *testing.T, gs *GameService, gameID, playerID string) *models.Game {
+	t.Helper()
+	game, err := gs.RequestTakeback(gameID, playerID)
+	if err != nil {
+		t.Fatalf("%s requests a takeback: %v", playerID, err)
+	}
+	if game, err = gs.RespondTakeback(gameID, opponentOf(game, playerID), true); err != nil {
+		t.Fatalf("takeback for %s: %v", playerID, err)
+	}
+	return game
+}
+
+func TestTakebackRequests(t *testing.T) {
+	gs := NewGameService()
+	game, _ := gs.CreateGame("a", "a", "b", "b", false, models.GameOptions{})
+
+	if _, err := gs.RequestTakeback(game.ID, "a"); !errors.Is(err, ErrNothingToTakeBack) {
+		t.Errorf("takeback before any move: %v, want ErrNothingToTakeBack", err)
+	}
+	playMovesOn(t, gs, game.ID, drops(3)...)
+	if _, err := gs.RequestTakeback(game.ID, "b"); !errors.Is(err, ErrNothingToTakeBack) {
+		t.Errorf("takeback before b moved: %v, want ErrNothingToTakeBack", err)
+	}
+	if _, err := gs.RequestTakeback(game.ID, "c"); !errors.Is(err, ErrNotInGame) {
+		t.Errorf("takeback by a spectator: %v, want ErrNotInGame", err)
+	}
+	if _, err := gs.RespondTakeback(game.ID, "b", true); !errors.Is(err, ErrNoTakebackRequest) {
+		t.Errorf("answer without a request: %v, want ErrNoTakebackRequest", err)
+	}
+
+	if _, err := gs.RequestTakeback(game.ID, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gs.RequestTakeback(game.ID, "a"); !errors.Is(err, ErrTakebackPending) {
+		t.Errorf("second request: %v, want ErrTakebackPending", err)
+	}
+	if _, err := gs.RespondTakeback(game.ID, "a", true); !errors.Is(err, ErrNotTakebackResponder) {
+		t.Errorf("requester accepts: %v, want ErrNotTakebackResponder", err)
+	}
+
+	// A refused takeback leaves the game as it was
+	game, err := gs.RespondTakeback(game.ID, "b", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if game.TakebackRequestedBy != "" || len(game.Moves) != 1 || game.CurrentTurn != "b" || game.Board[5][3] != 1 {
+		t.Errorf("after a refusal: request by %q, %d moves, %s to move", game.TakebackRequestedBy, len(game.Moves), game.CurrentTurn)
+	}
+	if _, err := gs.RespondTakeback(game.ID, "b", true); !errors.Is(err, ErrNoTakebackRequest) {
+		t.Errorf("answer after a refusal: %v, want ErrNoTakebackRequest", err)
+	}
+
+	// A move by the opponent drops the pending request
+	gs.RequestTakeback(game.ID, "a")
+	game = playMovesOn(t, gs, game.ID, drops(4)...)
+	if game.TakebackRequestedBy != "" {
+		t.Errorf("request by %s still pending after a move", game.TakebackRequestedBy)
+	}
+
+	// Not on move: a's takeback undoes b's reply too
+	game = takeBack(t, gs, game.ID, "a")
+	if len(game.Moves) != 0 || game.CurrentTurn != "a" || game.Board[5][3] != 0 || game.Board[5][4] != 0 {
+		t.Errorf("after taking back with b's reply: %d moves, %s to move", len(game.Moves), game.CurrentTurn)
+	}
+
+	finished, _ := gs.CreateGame("a", "a", "b", "b", false, models.GameOptions{})
+	playMovesOn(t, gs, finished.ID, drops(3)...)
+	gs.Resign(finished.ID, "b")
+	if _, err := gs.RequestTakeback(finished.ID, "a"); !errors.Is(err, ErrGameNotActive) {
+		t.Errorf("takeback after the game ended: %v, want ErrGameNotActive", err)
+	}
+}
+
+// TestTakebackThenWin takes back a move that blocked a win, after which
+// the same winning move must still be found.
+func TestTakebackThenWin(t *testing.T) {
+	gs := NewGameService()
+	game, _ := gs.CreateGame("a", "a", "b", "b", false, models.GameOptions{})
+	// a stacks three in column 0; b blocks on top
+	game = playMovesOn(t, gs, game.ID, drops(0, 1, 0, 1, 0, 0)...)
+
+	game = takeBack(t, gs, game.ID, "b")
+	if len(game.Moves) != 5 || game.CurrentTurn != "b" || game.Board[2][0] != 0 {
+		t.Fatalf("after b's takeback: %d moves, %s to move", len(game.Moves), game.CurrentTurn)
+	}
+	if game.Status != "active" || game.Winner != "" || game.WinningLines != nil {
+		t.Fatalf("after b's takeback: %s, won by %q", game.Status, game.Winner)
+	}
+
+	game = playMovesOn(t, gs, game.ID, drops(1, 0)...)
+	if game.Status != "won" || game.Winner != "a" || len(game.WinningLines) != 1 {
+		t.Fatalf("after the winning drop: %s, won by %q with %d lines", game.Status, game.Winner, len(game.WinningLines))
+	}
+	if len(game.Moves) != 7 || game.Moves[6].Ply != 7 || game.WinningMove == nil || game.WinningMove.Ply != 7 {
+		t.Errorf("moves after the takeback were not renumbered: %+v", game.Moves)
+	}
+}
+
+func TestTakebackPopOut(t *testing.T) {
+	gs := NewGameService()
+	game, _ := gs.CreateGame("a", "a", "b", "b", false, models.GameOptions{Variant: models.VariantPopOut})
+	pop := models.MovePayload{Column: 0, Kind: models.MovePop}
+	game = playMovesOn(t, gs, game.ID, models.MovePayload{Column: 0}, models.MovePayload{Column: 0}, pop)
+	if game.Board[5][0] != 2 || game.Board[4][0] != 0 {
+		t.Fatalf("after the pop: column 0 holds %d under %d", game.Board[5][0], game.Board[4][0])
+	}
+
+	// Undoing the pop puts a's disc back under b's
+	game = takeBack(t, gs, game.ID, "a")
+	if game.Board[5][0] != 1 || game.Board[4][0] != 2 || game.CurrentTurn != "a" || len(game.Moves) != 2 {
+		t.Fatalf("after undoing the pop: column 0 holds %d under %d, %s to move", game.Board[5][0], game.Board[4][0], game.CurrentTurn)
+	}
+
+	// The pop is legal again, and b can pop the disc that falls
+	game = playMovesOn(t, gs, game.ID, pop, pop)
+	if game.Board[5][0] != 0 || game.CurrentTurn != "a" {
+		t.Errorf("after both pops: column 0 holds %d, %s to move", game.Board[5][0], game.CurrentTurn)
+	}
+}
@@ -0,0 +1,152 @@
+package solver
+
+import (
+	"math/bits"
+	"time"
+
+	"4-in-a-row/engine"
+)
+
+// Scores from the limited search are scaled so that heuristic values
+// always lie strictly between proven losses and proven wins.
+const provenScale = 1000
+
+// Search looks at most depth plies ahead, deepening one ply at a time
+// until depth is reached or the deadline passes, and returns the best
+// move of the deepest completed iteration. A zero deadline means no time
+// limit. The result is exact when the search proved a win or a loss, or
+// reached the end of the game on every line.
+func (s *Solver) Search(pos *engine.Position, depth int, deadline time.Time) (Result, error) {
+	if pos.Winner() != 0 || pos.Full() {
+		return Result{Column: -1}, ErrGameOver
+	}
+	s.prepare(pos, deadline)
+	start := s.nodes
+	remaining := cells(pos) - pos.Moves()
+	if depth > remaining {
+		depth = remaining
+	}
+
+	order := columnOrder(pos.Columns())
+	for _, col := range order {
+		if pos.CanPlay(col) && pos.IsWinningDrop(pos.ToMove(), col) {
+			score := (cells(pos) + 1 - pos.Moves()) / 2
+			return s.result(pos, score, col, true, s.nodes-start), nil
+		}
+	}
+
+	best, bestScore := -1, 0
+	for _, col := range order {
+		if pos.CanPlay(col) {
+			best = col
+			break
+		}
+	}
+	completed := 0
+	for d := 1; d <= depth; d++ {
+		col, score, ok := s.searchRoot(pos, d, best)
+		if !ok {
+			break
+		}
+		best, bestScore, completed = col, score, d
+		if score >= provenScale || score <= -provenScale {
+			break
+		}
+	}
+
+	if bestScore >= provenScale || bestScore <= -provenScale {
+		return s.result(pos, bestScore/provenScale, best, true, s.nodes-start), nil
+	}
+	// a draw is only proven by an iteration that saw every line to the end
+	if completed == remaining && bestScore == 0 {
+		return s.result(pos, 0, best, true, s.nodes-start), nil
+	}
+	r := s.result(pos, bestScore, best, false, s.nodes-start)
+	return r, nil
+}
+
+// searchRoot runs one depth-limited iteration, trying the previous
+// iteration's best move first. ok is false if the deadline passed.
+func (s *Solver) searchRoot(pos *engine.Position, depth int, first int) (best, bestScore int, ok bool) {
+	next := nonLosingMoves(pos)
+	if next == 0 {
+		// every move loses; play the one that loses slowest
+		next = pos.Possible()
+	}
+	var c children
+	orderedChildren(pos, next, &c)
+	kids := c.pos[:c.n]
+	for i := range kids {
+		if kids[i].ColumnOf(kids[i].Mask()&^pos.Mask()) == first {
+			kids[0], kids[i] = kids[i], kids[0]
+			break
+		}
+	}
+
+	alpha, beta := -provenScale*cells(pos), provenScale*cells(pos)
+	best = -1
+	for i := range kids {
+		score, ok := s.limited(&kids[i], depth-1, -beta, -alpha)
+		if !ok {
+			return 0, 0, false
+		}
+		score = -score
+		if best == -1 || score > alpha {
+			alpha = score
+			best = kids[i].ColumnOf(kids[i].Mask() &^ pos.Mask())
+		}
+	}
+	return best, alpha, true
+}
+
+// limited is negamax cut off at depth, where positions are scored by
+// heuristic. Proven results are scaled by provenScale.
+func (s *Solver) limited(pos *engine.Position, depth, alpha, beta int) (int, bool) {
+	s.nodes++
+	if s.nodes&1023 == 0 && !s.deadline.IsZero() && time.Now().After(s.deadline) {
+		return 0, false
+	}
+	n := cells(pos)
+	moves := pos.Moves()
+
+	if canWinNext(pos) {
+		return provenScale * ((n + 1 - moves) / 2), true
+	}
+	next := nonLosingMoves(pos)
+	if next == 0 {
+		return -provenScale * ((n - moves) / 2), true
+	}
+	if moves >= n-2 {
+		return 0, true
+	}
+	if depth == 0 {
+		return heuristic(pos), true
+	}
+
+	var c children
+	orderedChildren(pos, next, &c)
+	for i := 0; i < c.n; i++ {
+		score, ok := s.limited(&c.pos[i], depth-1, -beta, -alpha)
+		if !ok {
+			return 0, false
+		}
+		score = -score
+		if score >= beta {
+			return score, true
+		}
+		if score > alpha {
+			alpha = score
+		}
+	}
+	return alpha, true
+}
+
+// heuristic scores a quiet position for the player to move by open
+// threats and central discs, well inside (-provenScale, provenScale).
+func heuristic(pos *engine.Position) int {
+	me, opp := pos.ToMove(), 3-pos.ToMove()
+	score := 16 * (bits.OnesCount64(pos.WinningCells(me)) - bits.OnesCount64(pos.WinningCells(opp)))
+	center := columnMask(pos, pos.Columns()/2)
+	score += 3 * (bits.OnesCount64(pos.Stones(me)&center) - bits.OnesCount64(pos.Stones(opp)&center))
+	return max(-provenScale+1, min(provenScale-1, score))
+}
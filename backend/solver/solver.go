@@ -0,0 +1,325 @@
+// Package solver computes exact game-theoretic values of Connect-N
+// positions under the standard (drop-only) rules, using negamax with
+// alpha-beta pruning, a transposition table, threat-based move ordering
+// and iterative null-window deepening. It also offers a depth- and
+// time-limited search for when a full solve is too expensive.
+package solver
+
+import (
+	"errors"
+	"math/bits"
+	"time"
+
+	"4-in-a-row/engine"
+)
+
+// DefaultTableBits sizes the transposition table at 2^22 entries (~36 MB).
+const DefaultTableBits = 22
+
+var (
+	ErrGameOver = errors.New("position is already decided")
+	ErrTimeout  = errors.New("solver ran out of time")
+)
+
+// Outcomes for the player to move.
+const (
+	OutcomeWin     = "win"
+	OutcomeLoss    = "loss"
+	OutcomeDraw    = "draw"
+	OutcomeUnknown = "unknown" // only from a search cut short by depth or time
+)
+
+// Result is the value of a position for the player to move.
+type Result struct {
+	// Score follows the usual Connect Four solver convention: positive
+	// when the mover wins, negative when they lose, 0 for a draw, and
+	// larger in magnitude the sooner the game is decided.
+	Score   int    `json:"score"`
+	Outcome string `json:"outcome"`
+	Plies   int    `json:"plies,omitempty"` // plies until the result with best play
+	Column  int    `json:"column"`          // best move, -1 if there is none
+	Exact   bool   `json:"exact"`
+	Nodes   uint64 `json:"nodes"`
+}
+
+// Solver holds the transposition table between calls. A Solver is not safe
+// for concurrent use; give each goroutine its own.
+type Solver struct {
+	table    *table
+	nodes    uint64
+	deadline time.Time
+	aborted  bool
+	// geometry of the positions in the table; it is cleared when this
+	// changes because keys are only unique for one board size
+	rows, columns, winLength int
+}
+
+// New returns a solver with a 2^tableBits entry transposition table.
+func New(tableBits int) *Solver {
+	return &Solver{table: newTable(tableBits)}
+}
+
+// Solve returns the exact score of pos for the player to move. It gives
+// up with ErrTimeout once deadline passes; a zero deadline means no limit.
+func (s *Solver) Solve(pos *engine.Position, deadline time.Time) (int, error) {
+	if pos.Winner() != 0 || pos.Full() {
+		return 0, ErrGameOver
+	}
+	s.prepare(pos, deadline)
+	score := s.solve(pos)
+	if s.aborted {
+		return 0, ErrTimeout
+	}
+	return score, nil
+}
+
+// Analyze returns the exact score of pos together with a best move. Among
+// equally good moves the one closest to the center is chosen. Like Solve
+// it gives up with ErrTimeout once deadline passes.
+func (s *Solver) Analyze(pos *engine.Position, deadline time.Time) (Result, error) {
+	if pos.Winner() != 0 || pos.Full() {
+		return Result{Column: -1}, ErrGameOver
+	}
+	s.prepare(pos, deadline)
+	start := s.nodes
+	score := s.solve(pos)
+
+	best := -1
+	for _, col := range columnOrder(pos.Columns()) {
+		if !pos.CanPlay(col) {
+			continue
+		}
+		var childScore int
+		if pos.IsWinningDrop(pos.ToMove(), col) {
+			childScore = (cells(pos) + 1 - pos.Moves()) / 2
+		} else {
+			child := *pos
+			child.Play(col)
+			if child.Full() {
+				childScore = 0
+			} else {
+				childScore = -s.solve(&child)
+			}
+		}
+		if s.aborted {
+			return Result{Column: -1}, ErrTimeout
+		}
+		if childScore == score {
+			best = col
+			break
+		}
+	}
+	return s.result(pos, score, best, true, s.nodes-start), nil
+}
+
+func (s *Solver) prepare(pos *engine.Position, deadline time.Time) {
+	s.deadline = deadline
+	s.aborted = false
+	if pos.Rows() != s.rows || pos.Columns() != s.columns || pos.WinLength() != s.winLength {
+		s.table.reset()
+		s.rows, s.columns, s.winLength = pos.Rows(), pos.Columns(), pos.WinLength()
+	}
+}
+
+// solve narrows the score window with null-window searches until the
+// exact value is known.
+func (s *Solver) solve(pos *engine.Position) int {
+	n := cells(pos)
+	if canWinNext(pos) {
+		return (n + 1 - pos.Moves()) / 2
+	}
+	lo := -(n - pos.Moves()) / 2
+	hi := (n + 1 - pos.Moves()) / 2
+	for lo < hi {
+		med := lo + (hi-lo)/2
+		if med <= 0 && lo/2 < med {
+			med = lo / 2
+		} else if med >= 0 && hi/2 > med {
+			med = hi / 2
+		}
+		r := s.negamax(pos, med, med+1)
+		if s.aborted {
+			return 0
+		}
+		if r <= med {
+			hi = r
+		} else {
+			lo = r
+		}
+	}
+	return lo
+}
+
+// negamax returns the exact score if it lies in (alpha, beta), otherwise
+// a bound on the same side. The mover cannot win on this move: the
+// parent only plays moves that leave no immediate win.
+func (s *Solver) negamax(pos *engine.Position, alpha, beta int) int {
+	s.nodes++
+	if s.nodes&4095 == 0 && !s.deadline.IsZero() && time.Now().After(s.deadline) {
+		s.aborted = true
+	}
+	if s.aborted {
+		return 0
+	}
+	n := cells(pos)
+	moves := pos.Moves()
+
+	next := nonLosingMoves(pos)
+	if next == 0 {
+		return -(n - moves) / 2
+	}
+	if moves >= n-2 {
+		return 0
+	}
+
+	if lo := -(n - 2 - moves) / 2; alpha < lo {
+		alpha = lo
+		if alpha >= beta {
+			return alpha
+		}
+	}
+	hi := (n - 1 - moves) / 2
+	if v := s.table.get(pos.Key()); v != 0 {
+		hi = int(v) + minScore(n) - 1
+	}
+	if beta > hi {
+		beta = hi
+		if alpha >= beta {
+			return beta
+		}
+	}
+
+	var c children
+	orderedChildren(pos, next, &c)
+	for i := 0; i < c.n; i++ {
+		score := -s.negamax(&c.pos[i], -beta, -alpha)
+		if s.aborted {
+			// the scores are meaningless now and must not reach the table
+			return 0
+		}
+		if score >= beta {
+			return score
+		}
+		if score > alpha {
+			alpha = score
+		}
+	}
+	s.table.put(pos.Key(), int8(alpha-minScore(n)+1))
+	return alpha
+}
+
+// result converts a score into a Result.
+func (s *Solver) result(pos *engine.Position, score, column int, exact bool, nodes uint64) Result {
+	r := Result{Score: score, Column: column, Exact: exact, Nodes: nodes}
+	if !exact {
+		r.Outcome = OutcomeUnknown
+		return r
+	}
+	n := cells(pos)
+	switch {
+	case score > 0:
+		r.Outcome = OutcomeWin
+		r.Plies = pliesToEnd(n, pos.Moves(), score, 1)
+	case score < 0:
+		r.Outcome = OutcomeLoss
+		r.Plies = pliesToEnd(n, pos.Moves(), -score, 0)
+	default:
+		r.Outcome = OutcomeDraw
+		r.Plies = n - pos.Moves()
+	}
+	return r
+}
+
+// pliesToEnd inverts the score formula score = (cells+2-end)/2, where end
+// is the number of discs on the board after the winning move; parity is 1
+// when the mover delivers the win and 0 when the opponent does.
+func pliesToEnd(cells, moves, score, parity int) int {
+	end := cells + 1 - 2*score
+	if (end-moves)%2 != parity {
+		end++
+	}
+	return end - moves
+}
+
+func cells(pos *engine.Position) int {
+	return pos.Rows() * pos.Columns()
+}
+
+func minScore(cells int) int {
+	return -cells/2 + 3
+}
+
+func canWinNext(pos *engine.Position) bool {
+	return pos.WinningCells(pos.ToMove())&pos.Possible() != 0
+}
+
+// nonLosingMoves returns the playable cells that do not let the opponent
+// win on their next move: a forced block if there is exactly one threat,
+// nothing if there are two, and never the cell right below a threat.
+func nonLosingMoves(pos *engine.Position) uint64 {
+	possible := pos.Possible()
+	threats := pos.WinningCells(3 - pos.ToMove())
+	if forced := possible & threats; forced != 0 {
+		if forced&(forced-1) != 0 {
+			return 0
+		}
+		possible = forced
+	}
+	return possible &^ (threats >> 1)
+}
+
+// children holds the moves of one node, best first.
+type children struct {
+	pos    [engine.MaxColumns]engine.Position
+	scores [engine.MaxColumns]int
+	n      int
+}
+
+// orderedChildren plays each move in moves and returns the children,
+// best first: moves that create more threats come first and ties go to
+// the more central column.
+func orderedChildren(pos *engine.Position, moves uint64, c *children) {
+	me := pos.ToMove()
+	c.n = 0
+	for _, col := range columnOrders[pos.Columns()] {
+		if moves&columnMask(pos, col) == 0 {
+			continue
+		}
+		i := c.n
+		c.pos[i] = *pos
+		c.pos[i].Play(col)
+		score := bits.OnesCount64(c.pos[i].WinningCells(me))
+		c.n++
+
+		// insertion sort, stable so center-first order breaks ties
+		for ; i > 0 && c.scores[i-1] < score; i-- {
+			c.pos[i], c.pos[i-1] = c.pos[i-1], c.pos[i]
+			c.scores[i] = c.scores[i-1]
+		}
+		c.scores[i] = score
+	}
+}
+
+func columnMask(pos *engine.Position, column int) uint64 {
+	stride := pos.Rows() + 1
+	return ((uint64(1) << uint(pos.Rows())) - 1) << uint(column*stride)
+}
+
+// columnOrders caches columnOrder for every supported width.
+var columnOrders = func() [engine.MaxColumns + 1][]int {
+	var orders [engine.MaxColumns + 1][]int
+	for c := range orders {
+		orders[c] = columnOrder(c)
+	}
+	return orders
+}()
+
+// columnOrder lists the columns from the center outwards.
+func columnOrder(columns int) []int {
+	order := make([]int, 0, columns)
+	for i := 0; i < columns; i++ {
+		// 3, 2, 4, 1, 5, 0, 6 for 7 columns
+		order = append(order, columns/2+(1-2*(i%2))*(i+1)/2)
+	}
+	return order
+}
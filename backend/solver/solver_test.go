@@ -0,0 +1,183 @@
+package solver
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"4-in-a-row/engine"
+)
+
+// minimax scores pos for the player to move by trying every line of play,
+// with the same score convention as the solver.
+func minimax(pos *engine.Position, memo map[uint64]int) int {
+	if score, ok := memo[pos.Hash()]; ok {
+		return score
+	}
+	n := cells(pos)
+	best := -n
+	for col := 0; col < pos.Columns(); col++ {
+		if !pos.CanPlay(col) {
+			continue
+		}
+		var score int
+		if pos.IsWinningDrop(pos.ToMove(), col) {
+			score = (n + 1 - pos.Moves()) / 2
+		} else {
+			child := *pos
+			child.Play(col)
+			if !child.Full() {
+				score = -minimax(&child, memo)
+			}
+		}
+		best = max(best, score)
+	}
+	memo[pos.Hash()] = best
+	return best
+}
+
+// play drops discs into the given columns, 1-based as in the usual test
+// sets.
+func play(t *testing.T, pos *engine.Position, moves string) {
+	t.Helper()
+	for _, ch := range moves {
+		col := int(ch - '1')
+		if !pos.CanPlay(col) || pos.Winner() != 0 {
+			t.Fatalf("illegal move %c in %s", ch, moves)
+		}
+		pos.Play(col)
+	}
+}
+
+// TestAnalyzeSmallBoards checks Analyze against full minimax from the
+// empty board and from random positions of small boards.
+func TestAnalyzeSmallBoards(t *testing.T) {
+	sizes := []struct{ rows, columns, winLength int }{
+		{4, 4, 3},
+		{4, 4, 4},
+		{5, 4, 3},
+		{5, 4, 4},
+	}
+	rng := rand.New(rand.NewSource(1))
+	for _, size := range sizes {
+		memo := make(map[uint64]int)
+		s := New(16)
+		for i := 0; i < 100; i++ {
+			pos, err := engine.New(size.rows, size.columns, size.winLength)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the first position is the empty board
+			for plies := rng.Intn(cells(pos)) * min(i, 1); plies > 0; plies-- {
+				col := rng.Intn(pos.Columns())
+				if !pos.CanPlay(col) || pos.IsWinningDrop(pos.ToMove(), col) {
+					continue
+				}
+				pos.Play(col)
+				if pos.Full() {
+					break
+				}
+			}
+			if pos.Full() {
+				continue
+			}
+
+			want := minimax(pos, memo)
+			r, err := s.Analyze(pos, time.Time{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.Score != want {
+				t.Fatalf("%dx%d N=%d %v: score %d, want %d", size.rows, size.columns, size.winLength, pos.Board(), r.Score, want)
+			}
+			if !pos.CanPlay(r.Column) {
+				t.Fatalf("%v: best move %d is not playable", pos.Board(), r.Column)
+			}
+			child := *pos
+			child.Play(r.Column)
+			got := 0
+			switch {
+			case child.Winner() != 0:
+				got = (cells(pos) + 1 - pos.Moves()) / 2
+			case !child.Full():
+				got = -minimax(&child, memo)
+			}
+			if got != want {
+				t.Errorf("%v: best move %d scores %d, want %d", pos.Board(), r.Column, got, want)
+			}
+		}
+	}
+}
+
+// TestAnalyzeKnownPositions checks 6x7 end-game lines from Pascal Pons'
+// solver test set (1-based columns, as there). Few enough cells are left
+// to check their scores against minimax too.
+func TestAnalyzeKnownPositions(t *testing.T) {
+	tests := []struct {
+		moves string
+		score int
+	}{
+		{"2252576253462244111563365343671351441", -1},
+		{"7422341735647741166133573473242566", 1},
+		{"23163416124767223154467471272416755633", 0},
+		{"65214673556155731566316327373221417", -1},
+	}
+	s := New(20)
+	for _, tt := range tests {
+		pos, _ := engine.New(6, 7, 4)
+		play(t, pos, tt.moves)
+		r, err := s.Analyze(pos, time.Time{})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.moves, err)
+		}
+		if r.Score != tt.score {
+			t.Errorf("%s: score %d, want %d", tt.moves, r.Score, tt.score)
+		}
+		if want := minimax(pos, make(map[uint64]int)); want != tt.score {
+			t.Errorf("%s: minimax says %d", tt.moves, want)
+		}
+	}
+}
+
+// TestSearchDeadline checks that a search too deep to finish returns a
+// move soon after its deadline, and that the exact solvers give up.
+func TestSearchDeadline(t *testing.T) {
+	pos, _ := engine.New(6, 7, 4)
+	s := New(16)
+	const limit = 50 * time.Millisecond
+
+	start := time.Now()
+	r, err := s.Search(pos, 42, start.Add(limit))
+	if elapsed := time.Since(start); elapsed > 4*limit {
+		t.Errorf("Search took %v with a %v limit", elapsed, limit)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Exact || !pos.CanPlay(r.Column) {
+		t.Errorf("Search = %+v, want an inexact result with a move", r)
+	}
+
+	start = time.Now()
+	if _, err := s.Solve(pos, start.Add(limit)); err != ErrTimeout {
+		t.Errorf("Solve: %v, want ErrTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 4*limit {
+		t.Errorf("Solve took %v with a %v limit", elapsed, limit)
+	}
+	if _, err := s.Analyze(pos, time.Now().Add(limit)); err != ErrTimeout {
+		t.Errorf("Analyze: %v, want ErrTimeout", err)
+	}
+}
+
+func TestGameOver(t *testing.T) {
+	pos, _ := engine.New(6, 7, 4)
+	play(t, pos, "1212121")
+	s := New(10)
+	if _, err := s.Analyze(pos, time.Time{}); err != ErrGameOver {
+		t.Errorf("Analyze: %v, want ErrGameOver", err)
+	}
+	if r, err := s.Search(pos, 4, time.Time{}); err != ErrGameOver || r.Column != -1 {
+		t.Errorf("Search: %+v, %v, want ErrGameOver", r, err)
+	}
+}
@@ -0,0 +1,39 @@
+package solver
+
+// table is a fixed-size transposition table keyed by engine.Position.Key.
+// Entries are overwritten on collision; storing the full key makes a
+// lookup either exact or a miss.
+type table struct {
+	keys   []uint64
+	values []int8
+	mask   uint64
+}
+
+func newTable(bits int) *table {
+	size := uint64(1) << uint(bits)
+	return &table{
+		keys:   make([]uint64, size),
+		values: make([]int8, size),
+		mask:   size - 1,
+	}
+}
+
+func (t *table) put(key uint64, value int8) {
+	i := key & t.mask
+	t.keys[i] = key
+	t.values[i] = value
+}
+
+// get returns 0 when key is not stored.
+func (t *table) get(key uint64) int8 {
+	i := key & t.mask
+	if t.keys[i] == key {
+		return t.values[i]
+	}
+	return 0
+}
+
+func (t *table) reset() {
+	clear(t.keys)
+	clear(t.values)
+}